@@ -0,0 +1,166 @@
+package hutils
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	defaultAsyncBufferSize    = 1024
+	defaultAsyncFlushInterval = time.Second
+	// 缓存的日志超过该字节数时立即写入底层writer
+	asyncWriteBufferSize = 256 * 1024
+)
+
+// ErrWriterClosed 写入已关闭的AsyncWriteSyncer
+var ErrWriterClosed = errors.New("hutils: async writer closed")
+
+// AsyncOpt 异步写日志配置
+type AsyncOpt struct {
+	// BufferSize 队列中最多缓存的日志条数, 默认1024
+	BufferSize int
+	// FlushInterval 定时刷新到底层writer的间隔, 默认1秒
+	FlushInterval time.Duration
+	// DropWhenFull 队列已满时丢弃日志并计数, 默认阻塞等待
+	DropWhenFull bool
+}
+
+type asyncEntry struct {
+	data []byte
+	// 不为nil时表示Sync请求, 刷新完成后返回结果
+	synced chan error
+}
+
+// AsyncWriteSyncer 异步写日志, 日志先进入有界队列, 由后台goroutine批量写入底层writer.
+// 批量写入时每条日志仍单独调用一次底层writer的Write, Sink等按Write区分日志的writer可以直接使用.
+// Sync会等待队列中已有的日志写入完成, 退出前需要调用Close或Sync.
+type AsyncWriteSyncer struct {
+	ws      zapcore.WriteSyncer
+	opt     AsyncOpt
+	queue   chan asyncEntry
+	dropped uint64
+	mu      sync.RWMutex
+	closed  bool
+	done    chan struct{}
+	// 关闭时刷新的结果
+	err error
+}
+
+func NewAsyncWriteSyncer(ws zapcore.WriteSyncer, opt AsyncOpt) *AsyncWriteSyncer {
+	if opt.BufferSize <= 0 {
+		opt.BufferSize = defaultAsyncBufferSize
+	}
+	if opt.FlushInterval <= 0 {
+		opt.FlushInterval = defaultAsyncFlushInterval
+	}
+	w := &AsyncWriteSyncer{
+		ws:    ws,
+		opt:   opt,
+		queue: make(chan asyncEntry, opt.BufferSize),
+		done:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write 日志放入队列, zap会复用p, 需要复制一份
+func (w *AsyncWriteSyncer) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+	entry := asyncEntry{data: append([]byte(nil), p...)}
+	if w.opt.DropWhenFull {
+		select {
+		case w.queue <- entry:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+		}
+		return len(p), nil
+	}
+	w.queue <- entry
+	return len(p), nil
+}
+
+// Sync 等待队列中已有的日志写入底层writer并调用其Sync
+func (w *AsyncWriteSyncer) Sync() error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return nil
+	}
+	synced := make(chan error, 1)
+	w.queue <- asyncEntry{synced: synced}
+	return <-synced
+}
+
+// Close 写入队列中剩余的日志并停止后台goroutine, 之后的写入返回ErrWriterClosed
+func (w *AsyncWriteSyncer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.queue)
+	w.mu.Unlock()
+	<-w.done
+	// stdout等不支持Sync的writer会返回错误, 只关心数据是否写入
+	_ = w.ws.Sync()
+	return w.err
+}
+
+// Dropped 队列已满时丢弃的日志条数
+func (w *AsyncWriteSyncer) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+func (w *AsyncWriteSyncer) run() {
+	defer close(w.done)
+	var (
+		pending [][]byte
+		size    int
+	)
+	// flush 逐条写入缓存的日志, 写入失败的日志被丢弃, 返回第一个错误
+	flush := func() error {
+		var err error
+		for _, data := range pending {
+			if _, writeErr := w.ws.Write(data); writeErr != nil && err == nil {
+				err = writeErr
+			}
+		}
+		pending, size = pending[:0], 0
+		return err
+	}
+	ticker := time.NewTicker(w.opt.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case entry, ok := <-w.queue:
+			if !ok {
+				w.err = flush()
+				return
+			}
+			if entry.synced != nil {
+				err := flush()
+				if syncErr := w.ws.Sync(); err == nil {
+					err = syncErr
+				}
+				entry.synced <- err
+				continue
+			}
+			pending = append(pending, entry.data)
+			size += len(entry.data)
+			if size >= asyncWriteBufferSize {
+				_ = flush()
+			}
+		case <-ticker.C:
+			_ = flush()
+		}
+	}
+}
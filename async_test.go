@@ -0,0 +1,158 @@
+package hutils
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+// blockingWriter 未放行前阻塞写入, 模拟慢磁盘
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+	syncs   int
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.syncs++
+	return nil
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func TestAsyncWriteSyncerSync(t *testing.T) {
+	ws := &blockingWriter{release: make(chan struct{})}
+	close(ws.release)
+	w := NewAsyncWriteSyncer(ws, AsyncOpt{FlushInterval: time.Hour})
+	_, err := w.Write([]byte("line1\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Sync())
+	assert.Equal(t, "line1\n", ws.String())
+	assert.Equal(t, 1, ws.syncs)
+
+	_, _ = w.Write([]byte("line2\n"))
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "line1\nline2\n", ws.String())
+	_, err = w.Write([]byte("line3\n"))
+	assert.Equal(t, ErrWriterClosed, err)
+	assert.NoError(t, w.Close())
+}
+
+// recordWriter 记录每次Write的内容
+type recordWriter struct {
+	mu     sync.Mutex
+	writes []string
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func (w *recordWriter) Sync() error {
+	return nil
+}
+
+func TestAsyncWriteSyncerKeepsEntryBoundaries(t *testing.T) {
+	ws := &recordWriter{}
+	w := NewAsyncWriteSyncer(ws, AsyncOpt{FlushInterval: time.Hour})
+	var expected []string
+	for i := 0; i < 5; i++ {
+		line := strings.Repeat(string(rune('a'+i)), i+1) + "\n"
+		expected = append(expected, line)
+		_, err := w.Write([]byte(line))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, expected, ws.writes)
+}
+
+func TestAsyncWriteSyncerDrop(t *testing.T) {
+	ws := &blockingWriter{release: make(chan struct{})}
+	w := NewAsyncWriteSyncer(ws, AsyncOpt{BufferSize: 2, DropWhenFull: true})
+	// 底层writer阻塞时写入不会阻塞, 超出队列的日志被丢弃
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			_, _ = w.Write(bytes.Repeat([]byte("x"), asyncWriteBufferSize))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("write blocked")
+	}
+	assert.Greater(t, w.Dropped(), uint64(0))
+	close(ws.release)
+	assert.NoError(t, w.Close())
+}
+
+func TestAsyncLogger(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true, Async: &AsyncOpt{FlushInterval: time.Hour}}).Sugar()
+		sugarLog.Info("async")
+		assert.NoError(t, logger.Close())
+		assert.Equal(t, uint64(0), logger.Dropped())
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, strings.Join(output, "\n"), "async")
+
+	var nilAsync Logger
+	assert.NoError(t, nilAsync.Close())
+	var _ zapcore.WriteSyncer = &AsyncWriteSyncer{}
+}
+
+// closeRecorder 记录Close调用次数的sink
+type closeRecorder struct {
+	recordWriter
+	closed int
+}
+
+func (w *closeRecorder) Close() error {
+	w.closed++
+	return nil
+}
+
+func TestLoggerRebuild(t *testing.T) {
+	sink := &closeRecorder{}
+	logger := &Logger{}
+	sugarLog := logger.Init(LoggerOpt{Sinks: []zapcore.WriteSyncer{sink}, Async: &AsyncOpt{FlushInterval: time.Hour}}).Sugar()
+	sugarLog.Info("first")
+
+	// 重新Build时写入之前异步队列中的日志, 继续使用的sink不会被关闭
+	_, err := logger.Build(LoggerOpt{Sinks: []zapcore.WriteSyncer{sink}, Async: &AsyncOpt{FlushInterval: time.Hour}})
+	assert.NoError(t, err)
+	assert.Len(t, sink.writes, 1)
+	assert.Contains(t, sink.writes[0], "first")
+	assert.Equal(t, 0, sink.closed)
+
+	// 不再使用的sink被关闭
+	_, err = logger.Build(LoggerOpt{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sink.closed)
+	assert.NoError(t, logger.Close())
+	assert.Equal(t, 1, sink.closed)
+}
@@ -0,0 +1,80 @@
+// hutils-logconv 将hutils的console格式日志(包括旧格式的AccessLog, RequestLog)转换为JSON Lines.
+//
+//	hutils-logconv [-o output.jsonl] [file ...]
+//
+// 没有指定文件或文件为"-"时读取标准输入.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/zaihui/go-hutils/parser"
+)
+
+func main() {
+	output := flag.String("o", "", "output file, default stdout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-o output.jsonl] [file ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		if err := convertFile(w, name); err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func convertFile(w io.Writer, name string) error {
+	if name == "-" {
+		return convert(w, os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return convert(w, f)
+}
+
+func convert(w io.Writer, r io.Reader) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	reader := parser.NewReader(r)
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(rec.JSON()); err != nil {
+			return err
+		}
+	}
+}
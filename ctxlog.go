@@ -0,0 +1,60 @@
+package hutils
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type (
+	ctxLoggerKey    struct{}
+	ctxLogFieldsKey struct{}
+)
+
+// ContextWithLogger 在ctx中保存logger, 之后通过LoggerFromContext获取
+func ContextWithLogger(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, ctxLoggerKey{}, logger)
+}
+
+// WithLogFields 在ctx中附加日志字段, 参数同zap.SugaredLogger.With, 如: WithLogFields(ctx, "user_id", 1)
+func WithLogFields(ctx context.Context, args ...interface{}) context.Context {
+	fields := LogFieldsFromContext(ctx)
+	merged := make([]interface{}, 0, len(fields)+len(args))
+	merged = append(append(merged, fields...), args...)
+	return context.WithValue(ctx, ctxLogFieldsKey{}, merged)
+}
+
+// LogFieldsFromContext 获取WithLogFields附加的日志字段
+func LogFieldsFromContext(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(ctxLogFieldsKey{}).([]interface{})
+	return fields
+}
+
+// LoggerFromContext 获取ContextWithLogger保存的logger, 附带ctx中的日志字段以及当前的trace id, span id.
+// ctx中没有logger时使用zap.S().
+func LoggerFromContext(ctx context.Context) *zap.SugaredLogger {
+	if ctx == nil {
+		return zap.S()
+	}
+	logger, ok := ctx.Value(ctxLoggerKey{}).(*zap.SugaredLogger)
+	if !ok || logger == nil {
+		logger = zap.S()
+	}
+	args := LogFieldsFromContext(ctx)
+	if traceCtx := TraceContextFromContext(ctx); traceCtx.IsValid() {
+		args = append(args[:len(args):len(args)],
+			zap.String("trace_id", traceCtx.TraceID), zap.String("span_id", traceCtx.SpanID))
+	}
+	if len(args) == 0 {
+		return logger
+	}
+	return logger.With(args...)
+}
+
+// withRequestLogger 拦截器、中间件在ctx中保存logger以及请求的method, client_ip
+func withRequestLogger(ctx context.Context, logger *zap.SugaredLogger, args ...interface{}) context.Context {
+	return ContextWithLogger(WithLogFields(ctx, args...), logger)
+}
@@ -0,0 +1,78 @@
+package hutils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestLoggerFromContext(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		traceID, _ := trace.TraceIDFromHex(testTraceID)
+		spanID, _ := trace.SpanIDFromHex("0102030405060708")
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+		ctx = ContextWithLogger(WithLogFields(ctx, "user_id", 1), sugarLog)
+		ctx = WithLogFields(ctx, "order_id", "A1")
+		LoggerFromContext(ctx).Info("TestLoggerFromContext")
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, output[0], "TestLoggerFromContext")
+	assert.Contains(t, output[0], `"user_id": 1`)
+	assert.Contains(t, output[0], `"order_id": "A1"`)
+	assert.Contains(t, output[0], `"trace_id": "`+testTraceID+`"`)
+	assert.Contains(t, output[0], `"span_id": "0102030405060708"`)
+
+	// 没有logger时不会panic
+	LoggerFromContext(nil).Info("nop")
+	LoggerFromContext(context.Background()).Info("nop")
+}
+
+func TestAccessLogInterceptorContextLogger(t *testing.T) {
+	// 需要设置propagator才能提取traceparent
+	InitTracerProvider()
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		interceptor := NewUnaryServerAccessLogInterceptor(sugarLog, nil)
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", testTraceParent))
+		info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Ping"}
+		_, err := interceptor(ctx, goodPing, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			LoggerFromContext(ctx).Info("business")
+			return goodPing, nil
+		})
+		assert.NoError(t, err)
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, output[0], "business")
+	assert.Contains(t, output[0], `"method": "/test.Service/Ping"`)
+	assert.Contains(t, output[0], `"trace_id": "`+testTraceID+`"`)
+}
+
+func TestHTTPAccessLogContextLogger(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		h := NewHTTPAccessLogMiddleware(sugarLog)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			LoggerFromContext(r.Context()).Info("business")
+		}))
+		req := httptest.NewRequest("GET", "/ping", nil)
+		req.RemoteAddr = "1.2.3.4:1234"
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	})
+	assert.NoError(t, err)
+	line := strings.Join(output, "\n")
+	assert.Contains(t, line, `"request": "/ping"`)
+	assert.Contains(t, line, `"client_ip": "1.2.3.4"`)
+}
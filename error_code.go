@@ -0,0 +1,171 @@
+package hutils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	LocaleZhCN = "zh-CN"
+	LocaleEnUS = "en-US"
+
+	// acceptLanguageKey grpc metadata中的语言, 与http header同名
+	acceptLanguageKey = "accept-language"
+)
+
+var (
+	// DefaultLocale 未指定语言或语言不支持时使用的语言
+	DefaultLocale = LocaleZhCN
+	// SupportedLocales Accept-Language可以匹配的语言
+	SupportedLocales = []string{LocaleZhCN, LocaleEnUS}
+)
+
+// Params 错误信息中{name}占位符的参数
+type Params map[string]interface{}
+
+var (
+	errorMessagesMu sync.RWMutex
+	errorMessages   = map[string]map[string]string{}
+)
+
+// RegisterErrorCode 注册业务码各语言的默认错误信息, 错误信息中可以使用{name}占位符, 如:
+// RegisterErrorCode(40401, map[string]string{LocaleZhCN: "用户{id}不存在", LocaleEnUS: "user {id} not found"})
+func RegisterErrorCode(code interface{}, messages map[string]string) {
+	errorMessagesMu.Lock()
+	defer errorMessagesMu.Unlock()
+	errorMessages[fmt.Sprintf("%v", code)] = messages
+}
+
+// ErrorMessage 获取业务码在该语言下的错误信息, 没有该语言时使用DefaultLocale, 未注册时返回业务码
+func ErrorMessage(locale string, code interface{}, params Params) string {
+	c := fmt.Sprintf("%v", code)
+	errorMessagesMu.RLock()
+	messages, ok := errorMessages[c]
+	errorMessagesMu.RUnlock()
+	if !ok {
+		return c
+	}
+	message, ok := messages[locale]
+	if !ok {
+		if message, ok = messages[DefaultLocale]; !ok {
+			return c
+		}
+	}
+	if len(params) == 0 {
+		return message
+	}
+	oldnew := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		oldnew = append(oldnew, "{"+k+"}", fmt.Sprintf("%v", v))
+	}
+	return strings.NewReplacer(oldnew...).Replace(message)
+}
+
+// NewCodeZError 使用注册的错误信息创建ZError, 语言从ctx中获取
+func NewCodeZError(ctx context.Context, code interface{}, params Params, options ...ZErrorOption) *ZError {
+	return NewZError(ctx, code, ErrorMessage(LocaleFromContext(ctx), code, params), options...)
+}
+
+type localeKey struct{}
+
+// WithLocale 在ctx中设置语言, 语言会按SupportedLocales规范化, 如en, en_US, EN-us都会设置为en-US
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, normalizeLocale(locale))
+}
+
+// normalizeLocale 规范化语言, 不在SupportedLocales中时返回BCP 47格式, 无法解析时保持不变
+func normalizeLocale(locale string) string {
+	if supported, ok := matchSupportedLocale(locale); ok {
+		return supported
+	}
+	if tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-")); err == nil {
+		return tag.String()
+	}
+	return locale
+}
+
+// matchSupportedLocale 匹配SupportedLocales, 忽略大小写并支持"_"分隔, 地区不同时按语言匹配
+func matchSupportedLocale(locale string) (string, bool) {
+	tag, err := language.Parse(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+	if err != nil {
+		return "", false
+	}
+	for _, supported := range SupportedLocales {
+		if t, err := language.Parse(supported); err == nil && t == tag {
+			return supported, true
+		}
+	}
+	base, _ := tag.Base()
+	for _, supported := range SupportedLocales {
+		if t, err := language.Parse(supported); err == nil {
+			if b, _ := t.Base(); b == base {
+				return supported, true
+			}
+		}
+	}
+	return "", false
+}
+
+// LocaleFromContext 依次从WithLocale, grpc metadata中的accept-language获取语言, 都没有时返回DefaultLocale
+func LocaleFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return DefaultLocale
+	}
+	if locale, ok := ctx.Value(localeKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(acceptLanguageKey); len(values) > 0 {
+			return MatchLocale(strings.Join(values, ","))
+		}
+	}
+	return DefaultLocale
+}
+
+// LocaleFromRequest 依次从WithLocale, Accept-Language header获取语言, 都没有时返回DefaultLocale
+func LocaleFromRequest(r *http.Request) string {
+	if locale, ok := r.Context().Value(localeKey{}).(string); ok && locale != "" {
+		return locale
+	}
+	return MatchLocale(r.Header.Get("Accept-Language"))
+}
+
+// MatchLocale 按Accept-Language的权重匹配SupportedLocales, 语言相同地区不同时也会匹配, 如en-GB匹配en-US
+func MatchLocale(acceptLanguage string) string {
+	type tag struct {
+		name string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		t := tag{name: strings.TrimSpace(fields[0]), q: 1}
+		for _, f := range fields[1:] {
+			if v := strings.TrimSpace(f); strings.HasPrefix(v, "q=") {
+				if q, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					t.q = q
+				}
+			}
+		}
+		if t.name != "" && t.q > 0 {
+			tags = append(tags, t)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+	for _, t := range tags {
+		if locale, ok := matchSupportedLocale(t.name); ok {
+			return locale
+		}
+	}
+	return DefaultLocale
+}
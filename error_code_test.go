@@ -0,0 +1,63 @@
+package hutils
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestErrorMessage(t *testing.T) {
+	RegisterErrorCode(40402, map[string]string{
+		LocaleZhCN: "用户{id}不存在",
+		LocaleEnUS: "user {id} not found",
+	})
+	assert.Equal(t, "用户42不存在", ErrorMessage(LocaleZhCN, 40402, Params{"id": 42}))
+	assert.Equal(t, "user 42 not found", ErrorMessage(LocaleEnUS, "40402", Params{"id": 42}))
+	// 不支持的语言使用默认语言
+	assert.Equal(t, "用户{id}不存在", ErrorMessage("ja-JP", 40402, nil))
+	assert.Equal(t, "unregistered", ErrorMessage(LocaleEnUS, "unregistered", nil))
+}
+
+func TestMatchLocale(t *testing.T) {
+	assert.Equal(t, LocaleEnUS, MatchLocale("en-US,en;q=0.9"))
+	assert.Equal(t, LocaleEnUS, MatchLocale("ja;q=0.9, en-GB;q=0.8"))
+	assert.Equal(t, LocaleZhCN, MatchLocale("en;q=0.5, zh-TW"))
+	assert.Equal(t, LocaleZhCN, MatchLocale("ja"))
+	assert.Equal(t, DefaultLocale, MatchLocale(""))
+	assert.Equal(t, LocaleEnUS, MatchLocale("en_us"))
+	assert.Equal(t, LocaleZhCN, MatchLocale("zh-Hans-CN"))
+}
+
+func TestNewCodeZError(t *testing.T) {
+	RegisterErrorCode(40403, map[string]string{
+		LocaleZhCN: "订单{id}不存在",
+		LocaleEnUS: "order {id} not found",
+	})
+	z := NewCodeZError(context.Background(), 40403, Params{"id": "A1"})
+	assert.Equal(t, "40403", z.Code)
+	assert.Equal(t, "订单A1不存在", z.Message)
+	// 其他格式同Error()
+	assert.Equal(t, "40403: 订单A1不存在", fmt.Sprintf("%d", z))
+	assert.Equal(t, "40403: 订单A1不存在", fmt.Sprintf("%x", z))
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "en-US"))
+	assert.Equal(t, "order A1 not found", NewCodeZError(ctx, 40403, Params{"id": "A1"}).Message)
+	// WithLocale优先于metadata
+	assert.Equal(t, "订单A1不存在", NewCodeZError(WithLocale(ctx, LocaleZhCN), 40403, Params{"id": "A1"}).Message)
+	assert.Equal(t, LocaleZhCN, LocaleFromContext(nil))
+	// WithLocale规范化语言
+	for _, locale := range []string{"en", "en_US", "EN-us"} {
+		assert.Equal(t, LocaleEnUS, LocaleFromContext(WithLocale(context.Background(), locale)))
+		assert.Equal(t, "order A1 not found", NewCodeZError(WithLocale(ctx, locale), 40403, Params{"id": "A1"}).Message)
+	}
+	assert.Equal(t, "ja-JP", LocaleFromContext(WithLocale(context.Background(), "ja_jp")))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "en-GB,en;q=0.9")
+	assert.Equal(t, LocaleEnUS, LocaleFromRequest(req))
+	assert.Equal(t, LocaleZhCN, LocaleFromRequest(req.WithContext(WithLocale(req.Context(), LocaleZhCN))))
+}
@@ -0,0 +1,96 @@
+package hutils
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// InternalErrorCode 非CodeError错误返回给客户端的业务码
+	InternalErrorCode = "INTERNAL"
+	// InternalErrorMessage 生产模式下非CodeError错误返回给客户端的信息
+	InternalErrorMessage = "internal error"
+)
+
+// WithProductionMode 生产模式下不向客户端返回内部错误信息和堆栈
+func WithProductionMode(production bool) func(*options) {
+	return func(options *options) {
+		options.production = production
+	}
+}
+
+// WithDebugInfo 非生产模式下在grpc状态的DebugInfo中返回被包装的错误及其堆栈, 未设置时同SetGRPCDebugInfo
+func WithDebugInfo(enable bool) func(*options) {
+	return func(options *options) {
+		options.debugInfo = enable
+	}
+}
+
+// NewUnaryServerErrorInterceptor 将handler返回的CodeError/ZError转换为grpc状态, context取消和超时返回对应的code,
+// 其他非CodeError错误记录日志后返回codes.Internal.
+func NewUnaryServerErrorInterceptor(logger *zap.SugaredLogger, opts ...Option) grpc.UnaryServerInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		return resp, options.translateError(ctx, logger, info.FullMethod, err)
+	}
+}
+
+// NewStreamServerErrorInterceptor 同NewUnaryServerErrorInterceptor, 用于stream.
+func NewStreamServerErrorInterceptor(logger *zap.SugaredLogger, opts ...Option) grpc.StreamServerInterceptor {
+	options := newOptions(opts...)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, stream)
+		return options.translateError(stream.Context(), logger, info.FullMethod, err)
+	}
+}
+
+// translateError 转换handler返回的错误
+func (o *options) translateError(ctx context.Context, logger *zap.SugaredLogger, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var codeErr CodeError
+	if errors.As(err, &codeErr) {
+		var z ZError
+		switch e := codeErr.(type) {
+		case *ZError:
+			z = *e
+		case ZError:
+			z = e
+		default:
+			z = *NewZError(ctx, codeErr.ErrCode(), codeErr.ErrMessage())
+		}
+		return z.grpcStatus(GRPCCode(z.Code), o.withDebugInfo()).Err()
+	}
+	// handler已经返回了grpc状态
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	// 被包装的grpc状态, status.FromError不会展开错误链
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &grpcErr) {
+		return grpcErr.GRPCStatus().Err()
+	}
+	// 客户端取消或超时不是服务端错误, 不记录错误日志
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	l := UnionLog{Request: method, LogType: grpcLogType}
+	l.Errorf(ctx, logger, "%+v", err)
+	z := NewZError(ctx, InternalErrorCode, err.Error(), WithError(err))
+	if o.production {
+		z.Message = InternalErrorMessage
+	}
+	return z.grpcStatus(codes.Internal, o.withDebugInfo()).Err()
+}
+
+// withDebugInfo 是否附带DebugInfo, 生产模式下始终不附带
+func (o *options) withDebugInfo() bool {
+	return !o.production && (o.debugInfo || grpcDebugInfo.Load())
+}
@@ -0,0 +1,98 @@
+package hutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type testCodeError struct{}
+
+func (testCodeError) Error() string      { return "40001: 参数错误" }
+func (testCodeError) ErrCode() string    { return "40001" }
+func (testCodeError) ErrMessage() string { return "参数错误" }
+
+func TestUnaryServerErrorInterceptor(t *testing.T) {
+	RegisterGRPCCode("40001", codes.InvalidArgument)
+	info := &grpc.UnaryServerInfo{FullMethod: "/mwitkow.testproto.TestService/Ping"}
+	call := func(production bool, handlerErr error, opts ...Option) (err error, output []string) {
+		output, _ = CaptureStdout(func() {
+			logger := &Logger{}
+			sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+			interceptor := NewUnaryServerErrorInterceptor(sugarLog, append(opts, WithProductionMode(production))...)
+			_, err = interceptor(context.Background(), goodPing, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, handlerErr
+			})
+		})
+		return err, output
+	}
+
+	err, output := call(false, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, strings.Join(output, ""))
+
+	// CodeError按注册的grpc code转换, 不记录日志
+	err, output = call(true, errors.Wrap(testCodeError{}, "wrapped"))
+	st := status.Convert(err)
+	assert.Equal(t, codes.InvalidArgument, st.Code())
+	assert.Equal(t, "参数错误", st.Message())
+	assert.Empty(t, strings.Join(output, ""))
+
+	// 默认和生产模式不返回DebugInfo
+	zErr := NewZError(nil, "40001", "参数错误", WithError(errors.New("invalid id")))
+	err, _ = call(false, zErr)
+	assert.Len(t, status.Convert(err).Details(), 1)
+	err, _ = call(true, zErr, WithDebugInfo(true))
+	assert.Len(t, status.Convert(err).Details(), 1)
+	err, _ = call(false, zErr, WithDebugInfo(true))
+	assert.Len(t, status.Convert(err).Details(), 2)
+
+	// 已经是grpc状态的错误保持不变
+	err, _ = call(false, status.Error(codes.NotFound, "not found"))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	// 被包装的grpc状态同样保持不变
+	err, output = call(false, fmt.Errorf("query user: %w", status.Error(codes.NotFound, "not found")))
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Equal(t, "not found", status.Convert(err).Message())
+	assert.Empty(t, strings.Join(output, ""))
+
+	// 客户端取消和超时转换为对应的grpc code, 不记录错误日志
+	err, output = call(false, context.Canceled)
+	assert.Equal(t, codes.Canceled, status.Code(err))
+	assert.Empty(t, strings.Join(output, ""))
+	err, output = call(false, errors.Wrap(context.DeadlineExceeded, "query user"))
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Empty(t, strings.Join(output, ""))
+
+	// 非CodeError错误记录堆栈, 生产模式隐藏错误信息
+	err, output = call(true, errors.New("db connection refused"))
+	st = status.Convert(err)
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.Equal(t, InternalErrorMessage, st.Message())
+	assert.Len(t, st.Details(), 1)
+	assert.Equal(t, InternalErrorCode, st.Details()[0].(*errdetails.ErrorInfo).Metadata["code"])
+	logs := strings.Join(output, "\n")
+	assert.Contains(t, logs, "db connection refused")
+	assert.Contains(t, logs, "TestUnaryServerErrorInterceptor")
+
+	err, _ = call(false, errors.New("db connection refused"))
+	assert.Equal(t, "db connection refused", status.Convert(err).Message())
+}
+
+func TestStreamServerErrorInterceptor(t *testing.T) {
+	RegisterGRPCCode("40001", codes.InvalidArgument)
+	interceptor := NewStreamServerErrorInterceptor(nil)
+	info := &grpc.StreamServerInfo{FullMethod: "/mwitkow.testproto.TestService/PingList"}
+	err := interceptor(nil, &fakeServerStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		return testCodeError{}
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,146 @@
+package hutils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+
+	// nolint:staticcheck
+	// ignore SA1019 Need to keep deprecated package for compatibility.
+	protoV1 "github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	errorInfoCodeKey    = "code"
+	errorInfoTraceIDKey = "trace_id"
+	errorInfoSpanIDKey  = "span_id"
+)
+
+// DefaultGRPCCode 未注册的业务码对应的grpc状态码
+var DefaultGRPCCode = codes.Unknown
+
+// grpcDebugInfo GRPCStatus是否附带DebugInfo
+var grpcDebugInfo atomic.Bool
+
+// SetGRPCDebugInfo 是否在grpc状态的DebugInfo中返回被包装的错误及其堆栈, 默认不返回, 不要在生产环境开启
+func SetGRPCDebugInfo(enable bool) {
+	grpcDebugInfo.Store(enable)
+}
+
+var (
+	grpcCodesMu sync.RWMutex
+	grpcCodes   = map[string]codes.Code{}
+)
+
+// RegisterGRPCCode 注册业务码对应的grpc状态码
+func RegisterGRPCCode(code interface{}, grpcCode codes.Code) {
+	grpcCodesMu.Lock()
+	defer grpcCodesMu.Unlock()
+	grpcCodes[fmt.Sprintf("%v", code)] = grpcCode
+}
+
+// GRPCCode 获取业务码对应的grpc状态码, 未注册时返回DefaultGRPCCode
+func GRPCCode(code string) codes.Code {
+	grpcCodesMu.RLock()
+	defer grpcCodesMu.RUnlock()
+	if grpcCode, ok := grpcCodes[code]; ok {
+		return grpcCode
+	}
+	return DefaultGRPCCode
+}
+
+// GRPCStatus 实现grpc status接口, 从grpc handler返回ZError时会转换为对应的grpc状态.
+// 业务码、trace id记录在ErrorInfo的Metadata中, Reason为grpc状态码的UPPER_SNAKE_CASE名称, 如NOT_FOUND, 通过SetGRPCDebugInfo开启后被包装的错误及其堆栈记录在DebugInfo中.
+func (z ZError) GRPCStatus() *status.Status {
+	return z.grpcStatus(GRPCCode(z.Code), grpcDebugInfo.Load())
+}
+
+// grpcStatus 生成grpc状态, debug为false时不附带DebugInfo
+func (z ZError) grpcStatus(grpcCode codes.Code, debug bool) *status.Status {
+	st := status.New(grpcCode, z.Message)
+	info := &errdetails.ErrorInfo{
+		Reason: errorInfoReason(grpcCode),
+		Domain: serviceName,
+		Metadata: map[string]string{
+			errorInfoCodeKey:    z.Code,
+			errorInfoTraceIDKey: z.TraceID,
+			errorInfoSpanIDKey:  z.SpanID,
+		},
+	}
+	details := []protoV1.Message{info}
+	if debug && z.Err != nil {
+		details = append(details, &errdetails.DebugInfo{
+			Detail:       z.Err.Error(),
+			StackEntries: stackEntries(z.Err),
+		})
+	}
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		return withDetails
+	}
+	return st
+}
+
+// errorInfoReason 将grpc状态码名称转换为ErrorInfo要求的UPPER_SNAKE_CASE, 如NotFound转换为NOT_FOUND
+func errorInfoReason(grpcCode codes.Code) string {
+	// 未定义的状态码名称为Code(n)
+	if grpcCode > codes.Unauthenticated {
+		return fmt.Sprintf("CODE_%d", uint32(grpcCode))
+	}
+	var b strings.Builder
+	var prev rune
+	for _, r := range grpcCode.String() {
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return b.String()
+}
+
+// stackEntries 获取github.com/pkg/errors记录的堆栈
+func stackEntries(err error) []string {
+	var tracer interface {
+		StackTrace() errors.StackTrace
+	}
+	if !errors.As(err, &tracer) {
+		return nil
+	}
+	stack := tracer.StackTrace()
+	entries := make([]string, len(stack))
+	for i, frame := range stack {
+		entries[i] = fmt.Sprintf("%+v", frame)
+	}
+	return entries
+}
+
+// ZErrorFromError 从grpc客户端收到的错误中还原ZError, 错误中没有记录业务码的ErrorInfo时返回false
+func ZErrorFromError(err error) (*ZError, bool) {
+	st, ok := status.FromError(err)
+	if !ok || st == nil {
+		return nil, false
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok {
+			continue
+		}
+		code, ok := info.GetMetadata()[errorInfoCodeKey]
+		if !ok {
+			continue
+		}
+		return &ZError{
+			Code:    code,
+			Message: st.Message(),
+			TraceID: info.GetMetadata()[errorInfoTraceIDKey],
+			SpanID:  info.GetMetadata()[errorInfoSpanIDKey],
+		}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,71 @@
+package hutils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestZErrorGRPCStatus(t *testing.T) {
+	RegisterGRPCCode(40400, codes.NotFound)
+	assert.Equal(t, codes.NotFound, GRPCCode("40400"))
+	assert.Equal(t, DefaultGRPCCode, GRPCCode("unregistered"))
+
+	z := NewZError(nil, 40400, "用户不存在", WithError(errors.New("record not found")))
+	z.TraceID = testTraceID
+	st, ok := status.FromError(z)
+	assert.True(t, ok)
+	assert.Equal(t, codes.NotFound, st.Code())
+	assert.Equal(t, "用户不存在", st.Message())
+
+	// 默认不返回DebugInfo
+	details := st.Details()
+	assert.Len(t, details, 1)
+	info := details[0].(*errdetails.ErrorInfo)
+	assert.Equal(t, "NOT_FOUND", info.Reason)
+	assert.Equal(t, "40400", info.Metadata["code"])
+	assert.Equal(t, testTraceID, info.Metadata["trace_id"])
+
+	SetGRPCDebugInfo(true)
+	defer SetGRPCDebugInfo(false)
+	details = status.Convert(z).Details()
+	assert.Len(t, details, 2)
+	debug := details[1].(*errdetails.DebugInfo)
+	assert.Equal(t, "record not found", debug.Detail)
+	assert.NotEmpty(t, debug.StackEntries)
+}
+
+func TestZErrorFromError(t *testing.T) {
+	z := NewZError(nil, "10086", "TestZErrorFromError")
+	z.TraceID = testTraceID
+	// 模拟客户端收到的错误
+	err := status.Convert(z).Err()
+	received, ok := ZErrorFromError(err)
+	assert.True(t, ok)
+	assert.Equal(t, "10086", received.Code)
+	assert.Equal(t, "TestZErrorFromError", received.Message)
+	assert.Equal(t, testTraceID, received.TraceID)
+	assert.Equal(t, z.Error(), received.Error())
+
+	// 其他服务返回的ErrorInfo没有业务码
+	other, err := status.New(codes.NotFound, "not found").WithDetails(&errdetails.ErrorInfo{Reason: "NOT_FOUND", Domain: "other"})
+	assert.NoError(t, err)
+	_, ok = ZErrorFromError(other.Err())
+	assert.False(t, ok)
+	_, ok = ZErrorFromError(status.Error(codes.Internal, "internal"))
+	assert.False(t, ok)
+	_, ok = ZErrorFromError(errors.New("plain"))
+	assert.False(t, ok)
+}
+
+func TestErrorInfoReason(t *testing.T) {
+	assert.Equal(t, "NOT_FOUND", errorInfoReason(codes.NotFound))
+	assert.Equal(t, "INVALID_ARGUMENT", errorInfoReason(codes.InvalidArgument))
+	assert.Equal(t, "UNKNOWN", errorInfoReason(codes.Unknown))
+	assert.Equal(t, "OK", errorInfoReason(codes.OK))
+	assert.Equal(t, "CODE_42", errorInfoReason(codes.Code(42)))
+}
@@ -0,0 +1,142 @@
+package hutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrorResponse http错误响应的json结构
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+var (
+	httpStatusesMu sync.RWMutex
+	httpStatuses   = map[string]int{}
+)
+
+// RegisterHTTPStatus 注册业务码对应的http状态码
+func RegisterHTTPStatus(code interface{}, httpStatus int) {
+	httpStatusesMu.Lock()
+	defer httpStatusesMu.Unlock()
+	httpStatuses[fmt.Sprintf("%v", code)] = httpStatus
+}
+
+// HTTPStatus 获取业务码对应的http状态码, 未注册时按RegisterGRPCCode注册的grpc状态码转换
+func HTTPStatus(code string) int {
+	httpStatusesMu.RLock()
+	httpStatus, ok := httpStatuses[code]
+	httpStatusesMu.RUnlock()
+	if ok {
+		return httpStatus
+	}
+	return httpStatusFromGRPCCode(GRPCCode(code))
+}
+
+// httpStatusFromGRPCCode 与grpc-gateway的转换规则一致
+func httpStatusFromGRPCCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// WriteError 将错误以ErrorResponse格式写入响应.
+// CodeError按HTTPStatus转换状态码, 其他错误返回500和InternalErrorMessage, 不向客户端暴露内部错误信息.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	httpStatus := http.StatusInternalServerError
+	resp := ErrorResponse{Code: InternalErrorCode, Message: InternalErrorMessage}
+	var codeErr CodeError
+	if errors.As(err, &codeErr) {
+		httpStatus = HTTPStatus(codeErr.ErrCode())
+		resp.Code = codeErr.ErrCode()
+		resp.Message = codeErr.ErrMessage()
+		switch z := codeErr.(type) {
+		case *ZError:
+			resp.TraceID, resp.SpanID = z.TraceID, z.SpanID
+		case ZError:
+			resp.TraceID, resp.SpanID = z.TraceID, z.SpanID
+		}
+	}
+	if resp.TraceID == "" {
+		tc := TraceContextFromContext(r.Context())
+		resp.TraceID, resp.SpanID = tc.TraceID, tc.SpanID
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(httpStatus)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// HandleError 将返回error的handler转换为http.Handler, 非CodeError错误会记录日志及堆栈
+func HandleError(logger *zap.SugaredLogger, f func(w http.ResponseWriter, r *http.Request) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := f(w, r); err != nil {
+			var codeErr CodeError
+			if !errors.As(err, &codeErr) {
+				l := UnionLog{Method: r.Method, Request: r.URL.RequestURI()}
+				l.Errorf(r.Context(), logger, "%+v", err)
+			}
+			WriteError(w, r, err)
+		}
+	})
+}
+
+// NewHTTPErrorMiddleware 捕获handler中的panic, 记录日志, 标记span为错误后以ErrorResponse格式返回.
+// panic的值为CodeError时同样记录日志, 按业务码返回, 其他返回500. 支持WithFilterURL.
+func NewHTTPErrorMiddleware(logger *zap.SugaredLogger, opts ...func(*handler)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := &errorHandler{
+			handler: handler{next: next, logger: logger},
+		}
+		for _, o := range opts {
+			o(&h.handler)
+		}
+		return h
+	}
+}
+
+// errorHandler 将panic转换为ErrorResponse, 复用handler的配置
+type errorHandler struct {
+	handler
+}
+
+func (h *errorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if FilterURL(h.filterURLs, r.URL.Path) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	rw := wrapResponseWriter(w, 0)
+	defer h.recoverPanic(rw, r)
+	h.next.ServeHTTP(rw.writer(), r)
+}
@@ -0,0 +1,99 @@
+package hutils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+func TestHTTPStatus(t *testing.T) {
+	RegisterHTTPStatus("42900", http.StatusTooManyRequests)
+	RegisterGRPCCode("40401", codes.NotFound)
+	assert.Equal(t, http.StatusTooManyRequests, HTTPStatus("42900"))
+	assert.Equal(t, http.StatusNotFound, HTTPStatus("40401"))
+	assert.Equal(t, http.StatusInternalServerError, HTTPStatus("unregistered"))
+}
+
+func TestHandleError(t *testing.T) {
+	RegisterHTTPStatus("40002", http.StatusBadRequest)
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		h := HandleError(sugarLog, func(w http.ResponseWriter, r *http.Request) error {
+			if r.URL.Path == "/internal" {
+				return errors.New("db connection refused")
+			}
+			z := NewZError(nil, "40002", "参数错误")
+			z.TraceID = testTraceID
+			return errors.Wrap(z, "wrapped")
+		})
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/ping", nil))
+		assert.Equal(t, http.StatusBadRequest, rw.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rw.Header().Get("Content-Type"))
+		var resp ErrorResponse
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+		assert.Equal(t, ErrorResponse{Code: "40002", Message: "参数错误", TraceID: testTraceID}, resp)
+
+		rw = httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/internal", nil))
+		assert.Equal(t, http.StatusInternalServerError, rw.Code)
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+		assert.Equal(t, InternalErrorCode, resp.Code)
+		assert.Equal(t, InternalErrorMessage, resp.Message)
+	})
+	assert.NoError(t, err)
+	logs := strings.Join(output, "\n")
+	assert.Contains(t, logs, "db connection refused")
+	assert.NotContains(t, logs, "参数错误")
+}
+
+func TestHTTPErrorMiddleware(t *testing.T) {
+	RegisterHTTPStatus("40301", http.StatusForbidden)
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		middleware := NewHTTPErrorMiddleware(sugarLog)
+		h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/forbidden":
+				panic(NewZError(r.Context(), "40301", "无权限"))
+			case "/written":
+				w.WriteHeader(http.StatusAccepted)
+				panic("after write")
+			}
+			panic("boom")
+		}))
+
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/forbidden", nil))
+		assert.Equal(t, http.StatusForbidden, rw.Code)
+		var resp ErrorResponse
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+		assert.Equal(t, "40301", resp.Code)
+
+		rw = httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/boom", nil))
+		assert.Equal(t, http.StatusInternalServerError, rw.Code)
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+		assert.Equal(t, InternalErrorMessage, resp.Message)
+
+		rw = httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/written", nil))
+		assert.Equal(t, http.StatusAccepted, rw.Code)
+		assert.Empty(t, rw.Body.String())
+	})
+	assert.NoError(t, err)
+	logs := strings.Join(output, "\n")
+	assert.Contains(t, logs, "panic: boom")
+	assert.Contains(t, logs, "panic: after write")
+	// panic的值为CodeError时同样记录日志及堆栈
+	assert.Contains(t, logs, "panic: 40301: 无权限")
+}
@@ -4,26 +4,26 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"strings"
+	"sync"
 	"time"
 
-	"go.opentelemetry.io/otel/trace"
-
 	"github.com/SkyAPM/go2sky"
-	"github.com/SkyAPM/go2sky/propagation"
 
 	// nolint:staticcheck
 	// ignore SA1019 Need to keep deprecated package for compatibility.
 	"github.com/golang/protobuf/proto"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_logging "github.com/grpc-ecosystem/go-grpc-middleware/logging"
 	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	"go.elastic.co/apm"
-	"go.opentelemetry.io/otel"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 	v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
@@ -33,6 +33,7 @@ const (
 
 	HTTP2Protocol         = "HTTP/2"
 	LocalHost             = "127.0.0.1"
+	LocalHostIPv6         = "::1"
 	ComponentIDGrpcClient = 5013
 	ComponentIDGrpcGo     = 23
 )
@@ -48,31 +49,46 @@ func MarshalJSON(msg interface{}) ([]byte, error) {
 	return nil, fmt.Errorf("msg not valid: %v", msg)
 }
 
+// SetTrace 在ctx中生成trace信息, span和transaction在返回前就已结束.
+//
+// Deprecated: span不覆盖请求处理过程, 请使用NewUnaryServerOtelInterceptor等拦截器.
 func SetTrace(ctx context.Context, name string, apmTracer *apm.Tracer) context.Context {
-	tp := sdktrace.NewTracerProvider()
-	otel.SetTracerProvider(tp)
-	defer otel.SetTracerProvider(tp)
-	tracer := otel.GetTracerProvider().Tracer("grpc")
-	ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
-	defer span.End()
-	if apmTracer != nil {
-		tx := apmTracer.StartTransaction(name, "grpc")
-		defer tx.End()
-		ctx = apm.ContextWithTransaction(ctx, tx)
-	}
+	ctx, end := startGrpcServerTrace(ctx, name, apmTracer)
+	end(nil)
 	return ctx
 }
 
+// ClientIPFromContext 从grpc peer信息中获取客户端ip
+func ClientIPFromContext(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// isLocalHost 本机的探针请求, 不记录访问日志
+func isLocalHost(ip string) bool {
+	return ip == LocalHost || ip == LocalHostIPv6
+}
+
 // NewUnaryServerAccessLogInterceptor returns a new unary server interceptors tha log access log
-func NewUnaryServerAccessLogInterceptor(logger *zap.SugaredLogger, apmTracer *apm.Tracer) grpc.UnaryServerInterceptor {
+func NewUnaryServerAccessLogInterceptor(logger *zap.SugaredLogger, apmTracer *apm.Tracer, opts ...Option) grpc.UnaryServerInterceptor {
+	options := newOptions(opts...)
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		ctx = SetTrace(ctx, info.FullMethod, apmTracer)
+		ctx, end := startGrpcServerTrace(ctx, info.FullMethod, apmTracer)
+		ctx = withRequestLogger(ctx, logger, "method", info.FullMethod, "client_ip", ClientIPFromContext(ctx))
 		startTime := time.Now()
-		ip, _ := peer.FromContext(ctx)
 		resp, err := handler(ctx, req)
-		clientIP := strings.Split(ip.Addr.String(), ":")[0]
+		end(err)
+		clientIP := ClientIPFromContext(ctx)
 		// ignore probe requests
-		if clientIP == LocalHost {
+		if isLocalHost(clientIP) {
 			return resp, err
 		}
 		code := grpc_logging.DefaultErrorToCode(err)
@@ -84,17 +100,274 @@ func NewUnaryServerAccessLogInterceptor(logger *zap.SugaredLogger, apmTracer *ap
 			LogType:    grpcLogType,
 			GrpcStatus: code.String(),
 		}
-		if msg, ok := req.(proto.Message); ok {
-			l.Payload, _ = MarshalJSON(msg)
-		}
-		if msg, ok := resp.(proto.Message); ok {
-			l.Response, _ = MarshalJSON(msg)
+		if options.logPayload(info.FullMethod, incomingContentType(ctx)) {
+			if msg, ok := req.(proto.Message); ok {
+				l.Payload = options.marshalPayload(msg)
+			}
+			if msg, ok := resp.(proto.Message); ok {
+				l.Response = options.marshalPayload(msg)
+			}
 		}
 		l.Log(ctx, logger)
 		return resp, err
 	}
 }
 
+// NewStreamServerAccessLogInterceptor returns a new stream server interceptors that log access log,
+// one UnionLog per stream.
+func NewStreamServerAccessLogInterceptor(logger *zap.SugaredLogger, apmTracer *apm.Tracer, opts ...Option) grpc.StreamServerInterceptor {
+	options := newOptions(opts...)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, end := startGrpcServerTrace(stream.Context(), info.FullMethod, apmTracer)
+		ctx = withRequestLogger(ctx, logger, "method", info.FullMethod, "client_ip", ClientIPFromContext(ctx))
+		startTime := time.Now()
+		maxMessages := options.logMessages
+		if !options.logPayload(info.FullMethod, incomingContentType(ctx)) {
+			maxMessages = 0
+		}
+		wrapped := &accessLogServerStream{
+			WrappedServerStream: grpc_middleware.WrapServerStream(stream),
+			maxMessages:         maxMessages,
+			redactor:            options.redactor,
+		}
+		wrapped.WrappedContext = ctx
+		err := handler(srv, wrapped)
+		end(err)
+		clientIP := ClientIPFromContext(ctx)
+		// ignore probe requests
+		if isLocalHost(clientIP) {
+			return err
+		}
+		code := grpc_logging.DefaultErrorToCode(err)
+		l := UnionLog{
+			ClientIP:    clientIP,
+			Request:     info.FullMethod,
+			Protocol:    HTTP2Protocol,
+			Duration:    time.Since(startTime).Milliseconds(),
+			LogType:     grpcLogType,
+			GrpcStatus:  code.String(),
+			Payload:     options.payloadLimiter.Truncate(joinMessages(wrapped.received)),
+			Response:    options.payloadLimiter.Truncate(joinMessages(wrapped.sent)),
+			MsgReceived: wrapped.receivedCount,
+			MsgSent:     wrapped.sentCount,
+		}
+		l.Log(ctx, logger)
+		return err
+	}
+}
+
+// accessLogServerStream 统计stream收发的消息数, 并保留前maxMessages条消息用于日志记录
+type accessLogServerStream struct {
+	*grpc_middleware.WrappedServerStream
+	redactor      *Redactor
+	maxMessages   int
+	sentCount     int
+	receivedCount int
+	sent          [][]byte
+	received      [][]byte
+}
+
+func (s *accessLogServerStream) SendMsg(m interface{}) error {
+	err := s.WrappedServerStream.SendMsg(m)
+	if err == nil {
+		s.sentCount++
+		s.sent = recordMessage(s.sent, s.maxMessages, s.redactor, m)
+	}
+	return err
+}
+
+func (s *accessLogServerStream) RecvMsg(m interface{}) error {
+	err := s.WrappedServerStream.RecvMsg(m)
+	if err == nil {
+		s.receivedCount++
+		s.received = recordMessage(s.received, s.maxMessages, s.redactor, m)
+	}
+	return err
+}
+
+// recordMessage 在未达到max条时追加序列化后的消息
+func recordMessage(messages [][]byte, max int, redactor *Redactor, m interface{}) [][]byte {
+	if len(messages) >= max {
+		return messages
+	}
+	if b, err := redactor.Marshal(m); err == nil {
+		messages = append(messages, b)
+	}
+	return messages
+}
+
+// joinMessages 将多条json消息拼接为json数组
+func joinMessages(messages [][]byte) []byte {
+	if len(messages) == 0 {
+		return nil
+	}
+	b := &bytes.Buffer{}
+	b.WriteByte('[')
+	b.Write(bytes.Join(messages, []byte(",")))
+	b.WriteByte(']')
+	return b.Bytes()
+}
+
+// NewUnaryClientAccessLogInterceptor returns a new unary client interceptors that log access log of outbound calls.
+func NewUnaryClientAccessLogInterceptor(logger *zap.SugaredLogger, opts ...Option) grpc.UnaryClientInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		startTime := time.Now()
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		code := grpc_logging.DefaultErrorToCode(err)
+		l := UnionLog{
+			Target:     cc.Target(),
+			Request:    method,
+			Protocol:   HTTP2Protocol,
+			Duration:   time.Since(startTime).Milliseconds(),
+			LogType:    grpcClientLogType,
+			GrpcStatus: code.String(),
+		}
+		if options.logPayload(method, "") {
+			l.Payload = options.marshalPayload(req)
+			if err == nil {
+				l.Response = options.marshalPayload(reply)
+			}
+		}
+		l.Log(ctx, logger)
+		return err
+	}
+}
+
+// NewStreamClientAccessLogInterceptor returns a new stream client interceptors that log access log of outbound streams,
+// the log is written when the stream is finished.
+func NewStreamClientAccessLogInterceptor(logger *zap.SugaredLogger, opts ...Option) grpc.StreamClientInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		startTime := time.Now()
+		l := UnionLog{
+			Target:   cc.Target(),
+			Request:  method,
+			Protocol: HTTP2Protocol,
+			LogType:  grpcClientLogType,
+		}
+		stream, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			l.Duration = time.Since(startTime).Milliseconds()
+			l.GrpcStatus = grpc_logging.DefaultErrorToCode(err).String()
+			l.Log(ctx, logger)
+			return nil, err
+		}
+		maxMessages := options.logMessages
+		if !options.logPayload(method, "") {
+			maxMessages = 0
+		}
+		s := &accessLogClientStream{
+			ClientStream: stream,
+			maxMessages:  maxMessages,
+			redactor:     options.redactor,
+		}
+		s.clientStreamDone = newClientStreamDone(ctx, desc, func(err error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			l.Duration = time.Since(startTime).Milliseconds()
+			l.GrpcStatus = grpc_logging.DefaultErrorToCode(err).String()
+			l.Payload = options.payloadLimiter.Truncate(joinMessages(s.sent))
+			l.Response = options.payloadLimiter.Truncate(joinMessages(s.received))
+			l.MsgSent = s.sentCount
+			l.MsgReceived = s.receivedCount
+			l.Log(ctx, logger)
+		})
+		return s, nil
+	}
+}
+
+// accessLogClientStream 统计客户端stream收发的消息数, 在stream结束时记录日志
+type accessLogClientStream struct {
+	grpc.ClientStream
+	*clientStreamDone
+	mu            sync.Mutex
+	redactor      *Redactor
+	maxMessages   int
+	sentCount     int
+	receivedCount int
+	sent          [][]byte
+	received      [][]byte
+}
+
+func (s *accessLogClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.mu.Lock()
+		s.sentCount++
+		s.sent = recordMessage(s.sent, s.maxMessages, s.redactor, m)
+		s.mu.Unlock()
+	}
+	s.sendDone(err)
+	return err
+}
+
+func (s *accessLogClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.mu.Lock()
+		s.receivedCount++
+		s.received = recordMessage(s.received, s.maxMessages, s.redactor, m)
+		s.mu.Unlock()
+	}
+	s.recvDone(err)
+	return err
+}
+
+// clientStreamDone 判断客户端stream是否结束, 结束时只调用一次finish.
+// RecvMsg返回EOF或错误, 非服务端流(如CloseAndRecv)收到响应, 或ctx结束时stream结束.
+type clientStreamDone struct {
+	serverStreams bool
+	once          sync.Once
+	finished      chan struct{}
+	finish        func(err error)
+}
+
+func newClientStreamDone(ctx context.Context, desc *grpc.StreamDesc, finish func(err error)) *clientStreamDone {
+	d := &clientStreamDone{
+		serverStreams: desc.ServerStreams,
+		finished:      make(chan struct{}),
+		finish:        finish,
+	}
+	// 调用方放弃stream时只会取消ctx
+	go func() {
+		select {
+		case <-ctx.Done():
+			d.done(status.FromContextError(ctx.Err()).Err())
+		case <-d.finished:
+		}
+	}()
+	return d
+}
+
+func (d *clientStreamDone) done(err error) {
+	d.once.Do(func() {
+		close(d.finished)
+		d.finish(err)
+	})
+}
+
+// sendDone SendMsg返回io.EOF时, 需要由RecvMsg获取stream的状态
+func (d *clientStreamDone) sendDone(err error) {
+	if err != nil && err != io.EOF {
+		d.done(err)
+	}
+}
+
+func (d *clientStreamDone) recvDone(err error) {
+	switch {
+	case err == nil:
+		// 非服务端流只有一条响应, grpc不会再返回io.EOF
+		if !d.serverStreams {
+			d.done(nil)
+		}
+	case err == io.EOF:
+		d.done(nil)
+	default:
+		d.done(err)
+	}
+}
+
 type Option func(*options)
 
 type options struct {
@@ -102,6 +375,27 @@ type options struct {
 	reportTags []string
 	// filter some health check request.
 	filterMethods []string
+	// log the first N messages of a stream.
+	logMessages int
+	// redact payloads before logging.
+	redactor *Redactor
+	// limit payloads of access log.
+	payloadLimiter *PayloadLimiter
+	// hide internal errors from clients.
+	production bool
+	// return wrapped errors and stacks in DebugInfo.
+	debugInfo bool
+}
+
+func newOptions(opts ...Option) *options {
+	options := &options{
+		reportTags:    []string{},
+		filterMethods: []string{},
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return options
 }
 
 func WithFilterMethod(methods []string) func(*options) {
@@ -116,6 +410,50 @@ func WithReportTags(tags []string) func(*options) {
 	}
 }
 
+// WithLogMessages 在访问日志和skywalking span中记录stream前n条收发消息的内容, 默认只记录消息数
+func WithLogMessages(n int) func(*options) {
+	return func(options *options) {
+		options.logMessages = n
+	}
+}
+
+// WithRedactor 记录日志和span前对请求参数、响应结果脱敏
+func WithRedactor(redactor *Redactor) func(*options) {
+	return func(options *options) {
+		options.redactor = redactor
+	}
+}
+
+// WithPayloadLimiter 限制访问日志中请求参数、响应结果的记录
+func WithPayloadLimiter(limiter *PayloadLimiter) func(*options) {
+	return func(options *options) {
+		options.payloadLimiter = limiter
+	}
+}
+
+// logPayload 是否记录本次请求的请求参数、响应结果
+func (o *options) logPayload(method, contentType string) bool {
+	if o.payloadLimiter.SkipMethod(method) || o.payloadLimiter.SkipContentType(contentType) {
+		return false
+	}
+	return o.payloadLimiter.Sampled()
+}
+
+// marshalPayload 序列化并脱敏、截断请求参数或响应结果
+func (o *options) marshalPayload(msg interface{}) []byte {
+	b, _ := o.redactor.Marshal(msg)
+	return o.payloadLimiter.Truncate(b)
+}
+
+// incomingContentType 获取grpc请求的content-type
+func incomingContentType(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	return strings.Join(md.Get("content-type"), "")
+}
+
 func MarshalParam(v interface{}) string {
 	json, err := JSONMarshal(v)
 	if err != nil {
@@ -135,56 +473,51 @@ func FilterMethod(filterMethods []string, method string) bool {
 }
 
 // NewUnaryClientSkywalkingInterceptor skywalking client interceptor.
-func NewUnaryClientSkywalkingInterceptor(tracer *go2sky.Tracer) grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
-		span, ctx, err := tracer.CreateEntrySpan(ctx, method, func(key string) (string, error) {
-			return "", nil
+func NewUnaryClientSkywalkingInterceptor(tracer *go2sky.Tracer, opts ...Option) grpc.UnaryClientInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) (err error) {
+		if FilterMethod(options.filterMethods, method) {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		md := outgoingMetadata(ctx)
+		span, err := tracer.CreateExitSpan(ctx, method, cc.Target(), func(key, value string) error {
+			md.Set(key, value)
+			return nil
 		})
 		if err != nil {
-			return invoker(ctx, method, req, reply, cc, opts...)
+			return invoker(ctx, method, req, reply, cc, callOpts...)
 		}
-		s, ok := span.(go2sky.ReportedSpan)
-		if !ok {
-			return invoker(ctx, method, req, reply, cc, opts...)
+		span.SetComponent(ComponentIDGrpcClient)
+		span.SetSpanLayer(v3.SpanLayer_RPCFramework)
+		for _, k := range options.reportTags {
+			span.Tag(go2sky.Tag(k), strings.Join(md.Get(k), ""))
 		}
 		defer func() {
-			span.SetComponent(ComponentIDGrpcClient)
-			span.SetSpanLayer(v3.SpanLayer_RPCFramework)
-			span.Log(time.Now(), ReqTag, MarshalParam(req))
+			span.Log(time.Now(), ReqTag, options.redactor.MarshalParam(req))
 			if err != nil {
 				span.Error(time.Now(), RespTag, MarshalParam(err))
 			} else {
-				span.Log(time.Now(), RespTag, MarshalParam(reply))
+				span.Log(time.Now(), RespTag, options.redactor.MarshalParam(reply))
 			}
 			span.End()
 		}()
-		spanContext := &propagation.SpanContext{
-			Sample:             1,
-			TraceID:            s.Context().TraceID,
-			ParentSegmentID:    s.Context().SegmentID,
-			ParentSpanID:       s.Context().SpanID,
-			ParentEndpoint:     s.Context().FirstSpan.GetOperationName(),
-			CorrelationContext: s.Context().CorrelationContext,
-		}
-		ctx = metadata.NewOutgoingContext(ctx, map[string][]string{
-			propagation.Header:            {spanContext.EncodeSW8()},
-			propagation.HeaderCorrelation: {spanContext.EncodeSW8Correlation()},
-		})
-		err = invoker(ctx, method, req, reply, cc, opts...)
+		err = invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, callOpts...)
 		return err
 	}
 }
 
+// outgoingMetadata 复制ctx中已有的outgoing metadata, 用于合并追加trace header
+func outgoingMetadata(ctx context.Context) metadata.MD {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		return md.Copy()
+	}
+	return metadata.MD{}
+}
+
 // NewUnaryServerSkywalkingInterceptor skywalking server interceptor.
 // nolint: govet
 func NewUnaryServerSkywalkingInterceptor(tracer *go2sky.Tracer, opts ...Option) grpc.UnaryServerInterceptor {
-	options := &options{
-		reportTags:    []string{},
-		filterMethods: []string{},
-	}
-	for _, o := range opts {
-		o(options)
-	}
+	options := newOptions(opts...)
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		if FilterMethod(options.filterMethods, info.FullMethod) {
 			return handler(ctx, req)
@@ -203,11 +536,11 @@ func NewUnaryServerSkywalkingInterceptor(tracer *go2sky.Tracer, opts ...Option)
 			defer func() {
 				span.SetComponent(ComponentIDGrpcGo)
 				span.SetSpanLayer(v3.SpanLayer_RPCFramework)
-				span.Log(time.Now(), ReqTag, MarshalParam(req))
+				span.Log(time.Now(), ReqTag, options.redactor.MarshalParam(req))
 				if err != nil {
 					span.Error(time.Now(), RespTag, MarshalParam(err))
 				} else {
-					span.Log(time.Now(), RespTag, MarshalParam(reply))
+					span.Log(time.Now(), RespTag, options.redactor.MarshalParam(reply))
 				}
 				span.End()
 			}()
@@ -217,3 +550,176 @@ func NewUnaryServerSkywalkingInterceptor(tracer *go2sky.Tracer, opts ...Option)
 		return handler(ctx, req)
 	}
 }
+
+// NewStreamClientSkywalkingInterceptor skywalking stream client interceptor.
+func NewStreamClientSkywalkingInterceptor(tracer *go2sky.Tracer, opts ...Option) grpc.StreamClientInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if FilterMethod(options.filterMethods, method) {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+		md := outgoingMetadata(ctx)
+		span, err := tracer.CreateExitSpan(ctx, method, cc.Target(), func(key, value string) error {
+			md.Set(key, value)
+			return nil
+		})
+		if err != nil {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+		span.SetComponent(ComponentIDGrpcClient)
+		span.SetSpanLayer(v3.SpanLayer_RPCFramework)
+		for _, k := range options.reportTags {
+			span.Tag(go2sky.Tag(k), strings.Join(md.Get(k), ""))
+		}
+		stream, err := streamer(metadata.NewOutgoingContext(ctx, md), desc, cc, method, callOpts...)
+		if err != nil {
+			span.Error(time.Now(), RespTag, MarshalParam(err))
+			span.End()
+			return nil, err
+		}
+		s := &skywalkingClientStream{ClientStream: stream, span: span, options: options}
+		if options.logPayload(method, "") {
+			s.messages.max = options.logMessages
+		}
+		s.clientStreamDone = newClientStreamDone(ctx, desc, s.finish)
+		return s, nil
+	}
+}
+
+// skywalkingClientStream 在span上记录前几条收发的消息, stream结束时关闭span
+type skywalkingClientStream struct {
+	grpc.ClientStream
+	*clientStreamDone
+	mu       sync.Mutex
+	span     go2sky.Span
+	options  *options
+	messages spanMessages
+}
+
+func (s *skywalkingClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.log(ReqTag, m)
+	}
+	s.sendDone(err)
+	return err
+}
+
+func (s *skywalkingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.log(RespTag, m)
+	}
+	s.recvDone(err)
+	return err
+}
+
+func (s *skywalkingClientStream) log(tag string, m interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.messages.take(tag) {
+		s.span.Log(time.Now(), tag, string(s.options.marshalPayload(m)))
+	}
+}
+
+func (s *skywalkingClientStream) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.span.Error(time.Now(), RespTag, MarshalParam(err))
+	}
+	s.span.End()
+}
+
+// NewStreamServerSkywalkingInterceptor skywalking stream server interceptor.
+func NewStreamServerSkywalkingInterceptor(tracer *go2sky.Tracer, opts ...Option) grpc.StreamServerInterceptor {
+	options := newOptions(opts...)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if FilterMethod(options.filterMethods, info.FullMethod) {
+			return handler(srv, stream)
+		}
+		md, ok := metadata.FromIncomingContext(stream.Context())
+		if !ok {
+			return handler(srv, stream)
+		}
+		span, ctx, err := tracer.CreateEntrySpan(stream.Context(), info.FullMethod, func(key string) (string, error) {
+			return strings.Join(md.Get(key), ""), nil
+		})
+		if err != nil {
+			return handler(srv, stream)
+		}
+		span.SetComponent(ComponentIDGrpcGo)
+		span.SetSpanLayer(v3.SpanLayer_RPCFramework)
+		for _, k := range options.reportTags {
+			span.Tag(go2sky.Tag(k), strings.Join(md.Get(k), ""))
+		}
+		wrapped := &skywalkingServerStream{
+			WrappedServerStream: grpc_middleware.WrapServerStream(stream),
+			span:                span,
+			options:             options,
+		}
+		if options.logPayload(info.FullMethod, incomingContentType(ctx)) {
+			wrapped.messages.max = options.logMessages
+		}
+		wrapped.WrappedContext = ctx
+		err = handler(srv, wrapped)
+		if err != nil {
+			span.Error(time.Now(), RespTag, MarshalParam(err))
+		}
+		span.End()
+		return err
+	}
+}
+
+// skywalkingServerStream 在span上记录前几条收发的消息
+type skywalkingServerStream struct {
+	*grpc_middleware.WrappedServerStream
+	mu       sync.Mutex
+	span     go2sky.Span
+	options  *options
+	messages spanMessages
+}
+
+func (s *skywalkingServerStream) SendMsg(m interface{}) error {
+	err := s.WrappedServerStream.SendMsg(m)
+	if err == nil {
+		s.log(RespTag, m)
+	}
+	return err
+}
+
+func (s *skywalkingServerStream) RecvMsg(m interface{}) error {
+	err := s.WrappedServerStream.RecvMsg(m)
+	if err == nil {
+		s.log(ReqTag, m)
+	}
+	return err
+}
+
+func (s *skywalkingServerStream) log(tag string, m interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.messages.take(tag) {
+		s.span.Log(time.Now(), tag, string(s.options.marshalPayload(m)))
+	}
+}
+
+// spanMessages 限制stream span上记录的消息数, 请求和响应分别最多记录max条, 同WithLogMessages
+type spanMessages struct {
+	max       int
+	requests  int
+	responses int
+}
+
+// take 该方向的消息未达到max条时计数并返回true
+func (c *spanMessages) take(tag string) bool {
+	count := &c.responses
+	if tag == ReqTag {
+		count = &c.requests
+	}
+	if *count >= c.max {
+		return false
+	}
+	*count++
+	return true
+}
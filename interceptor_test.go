@@ -2,17 +2,29 @@ package hutils
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"net"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/SkyAPM/go2sky"
+	"github.com/SkyAPM/go2sky/propagation"
 	"github.com/SkyAPM/go2sky/reporter"
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_testing "github.com/grpc-ecosystem/go-grpc-middleware/testing"
 	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
 var (
@@ -26,6 +38,16 @@ type LogTestSuite struct {
 	reader, writer *os.File
 }
 
+type StreamLogTestSuite struct {
+	*grpc_testing.InterceptorTestSuite
+	reader, writer *os.File
+}
+
+type ClientLogTestSuite struct {
+	*grpc_testing.InterceptorTestSuite
+	reader, writer *os.File
+}
+
 type SkywalkingClientTestSuite struct {
 	*grpc_testing.InterceptorTestSuite
 	reader, writer *os.File
@@ -79,6 +101,268 @@ func (s *LogTestSuite) TestMarshalJSON() {
 	s.True(strings.Contains(string(buf), "goodPing"))
 }
 
+func TestStreamLogTestSuite(t *testing.T) {
+	r, w, _ := os.Pipe()
+	// 替换原有os.Stdout
+	os.Stdout = w
+	logger := &Logger{}
+	sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+	s := &StreamLogTestSuite{
+		InterceptorTestSuite: &grpc_testing.InterceptorTestSuite{
+			ServerOpts: []grpc.ServerOption{
+				grpc.StreamInterceptor(NewStreamServerAccessLogInterceptor(sugarLog, nil, WithLogMessages(2))),
+			},
+		},
+	}
+	s.reader = r
+	s.writer = w
+	suite.Run(t, s)
+}
+
+func (s *StreamLogTestSuite) TestNewStreamServerAccessLogInterceptor() {
+	stream, err := s.Client.PingList(s.SimpleCtx(), goodPing)
+	s.NoError(err)
+	count := 0
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		s.NoError(err)
+		count++
+	}
+	s.Equal(grpc_testing.ListResponseCount, count)
+
+	var buf bytes.Buffer
+	output := make(chan string, 1)
+	go func() {
+		io.Copy(&buf, s.reader)
+		output <- buf.String()
+		s.reader.Close()
+	}()
+	s.writer.Close()
+
+	o := strings.Split(<-output, "\n")
+	// 输出空行
+	s.Len(o, 1)
+	s.Equal(o[0], "")
+}
+
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (f *fakeServerStream) Context() context.Context {
+	if f.ctx != nil {
+		return f.ctx
+	}
+	return context.Background()
+}
+
+func (f *fakeServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (f *fakeServerStream) RecvMsg(m interface{}) error {
+	return nil
+}
+
+func TestAccessLogServerStream(t *testing.T) {
+	stream := &accessLogServerStream{
+		WrappedServerStream: grpc_middleware.WrapServerStream(&fakeServerStream{}),
+		maxMessages:         1,
+	}
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, stream.SendMsg(goodPing))
+	}
+	assert.NoError(t, stream.RecvMsg(goodPing))
+	assert.Equal(t, 3, stream.sentCount)
+	assert.Equal(t, 1, stream.receivedCount)
+	assert.Len(t, stream.sent, 1)
+	payload := joinMessages(stream.received)
+	assert.True(t, strings.HasPrefix(string(payload), "["))
+	assert.True(t, strings.Contains(string(payload), "goodPing"))
+	assert.Nil(t, joinMessages(nil))
+}
+
+func TestClientIPFromContext(t *testing.T) {
+	for addr, ip := range map[string]string{
+		"10.0.0.1:1234": "10.0.0.1",
+		"[::1]:1234":    "::1",
+		"[fe80::1]:80":  "fe80::1",
+	} {
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		assert.NoError(t, err)
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tcpAddr})
+		assert.Equal(t, ip, ClientIPFromContext(ctx))
+	}
+	assert.Equal(t, "", ClientIPFromContext(context.Background()))
+	assert.True(t, isLocalHost("::1"))
+}
+
+func TestStreamServerAccessLogRemotePeer(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		sugarLog := (&Logger{}).Init(LoggerOpt{EnableStdout: true}).Sugar()
+		interceptor := NewStreamServerAccessLogInterceptor(sugarLog, nil, WithLogMessages(1))
+		addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+		stream := &fakeServerStream{ctx: peer.NewContext(context.Background(), &peer.Peer{Addr: addr})}
+		info := &grpc.StreamServerInfo{FullMethod: "/test/PingStream"}
+		err := interceptor(nil, stream, info, func(srv interface{}, stream grpc.ServerStream) error {
+			assert.NoError(t, stream.RecvMsg(goodPing))
+			return stream.SendMsg(goodPing)
+		})
+		assert.NoError(t, err)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, output, 2)
+	assert.Contains(t, output[0], `"client_ip": "10.0.0.1"`)
+	assert.Contains(t, output[0], `"request": "/test/PingStream"`)
+	assert.Contains(t, output[0], `"grpc_status": "OK"`)
+	assert.Contains(t, output[0], `"payload": "[{\"value\":\"goodPing\"`)
+	assert.Contains(t, output[0], `"msg_received": 1`)
+}
+
+func TestClientLogTestSuite(t *testing.T) {
+	r, w, _ := os.Pipe()
+	// 替换原有os.Stdout
+	os.Stdout = w
+	logger := &Logger{}
+	sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+	s := &ClientLogTestSuite{
+		InterceptorTestSuite: &grpc_testing.InterceptorTestSuite{
+			ClientOpts: []grpc.DialOption{
+				grpc.WithUnaryInterceptor(NewUnaryClientAccessLogInterceptor(sugarLog)),
+				grpc.WithStreamInterceptor(NewStreamClientAccessLogInterceptor(sugarLog, WithLogMessages(1))),
+			},
+		},
+	}
+	s.reader = r
+	s.writer = w
+	suite.Run(t, s)
+}
+
+func (s *ClientLogTestSuite) TestClientAccessLogInterceptor() {
+	_, err := s.Client.Ping(s.SimpleCtx(), goodPing)
+	s.NoError(err)
+	stream, err := s.Client.PingList(s.SimpleCtx(), goodPing)
+	s.NoError(err)
+	for {
+		_, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		s.NoError(err)
+	}
+
+	var buf bytes.Buffer
+	output := make(chan string, 1)
+	go func() {
+		io.Copy(&buf, s.reader)
+		output <- buf.String()
+		s.reader.Close()
+	}()
+	s.writer.Close()
+
+	o := strings.Split(<-output, "\n")
+	// 一元调用和stream各输出一行, 最后是空行
+	s.Len(o, 3)
+	s.Contains(o[0], "/mwitkow.testproto.TestService/Ping")
+	s.Contains(o[0], grpcClientLogType)
+	s.Contains(o[1], "/mwitkow.testproto.TestService/PingList")
+	s.Contains(o[1], `"msg_received": 100`)
+}
+
+const uploadMethod = "/hutils.test.Upload/Upload"
+
+// uploadStreamDesc 测试用的客户端流方法, 接收多条PingRequest后返回一条PingResponse
+var uploadStreamDesc = grpc.StreamDesc{StreamName: "Upload", ClientStreams: true}
+
+// dialUploadServer 启动提供Upload方法的grpc服务, 返回连接和关闭函数
+func dialUploadServer(t *testing.T, opts ...grpc.DialOption) (*grpc.ClientConn, func()) {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	desc := uploadStreamDesc
+	desc.Handler = func(srv interface{}, stream grpc.ServerStream) error {
+		var count int32
+		for {
+			err := stream.RecvMsg(&pb_testproto.PingRequest{})
+			if err == io.EOF {
+				return stream.SendMsg(&pb_testproto.PingResponse{Counter: count})
+			}
+			if err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "hutils.test.Upload",
+		HandlerType: (*interface{})(nil),
+		Streams:     []grpc.StreamDesc{desc},
+	}, nil)
+	go server.Serve(listener)
+
+	opts = append(opts, grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	cc, err := grpc.Dial("bufnet", opts...)
+	assert.NoError(t, err)
+	return cc, func() {
+		cc.Close()
+		server.Stop()
+	}
+}
+
+// upload 与生成代码的CloseAndRecv一致, 发送n条消息后CloseSend, 再接收唯一的响应
+func upload(ctx context.Context, cc *grpc.ClientConn, n int) (*pb_testproto.PingResponse, error) {
+	stream, err := cc.NewStream(ctx, &uploadStreamDesc, uploadMethod)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		if err := stream.SendMsg(goodPing); err != nil {
+			return nil, err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	resp := &pb_testproto.PingResponse{}
+	return resp, stream.RecvMsg(resp)
+}
+
+func TestClientStreamingAccessLog(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		sugarLog := (&Logger{}).Init(LoggerOpt{EnableStdout: true}).Sugar()
+		cc, stop := dialUploadServer(t, grpc.WithStreamInterceptor(NewStreamClientAccessLogInterceptor(sugarLog)))
+		defer stop()
+		resp, err := upload(context.Background(), cc, 3)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(3), resp.Counter)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, output, 2)
+	assert.Contains(t, output[0], uploadMethod)
+	assert.Contains(t, output[0], `"grpc_status": "OK"`)
+	assert.Contains(t, output[0], `"msg_sent": 3`)
+	assert.Contains(t, output[0], `"msg_received": 1`)
+}
+
+func TestClientStreamDoneOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	finished := make(chan error, 2)
+	d := newClientStreamDone(ctx, &grpc.StreamDesc{ServerStreams: true}, func(err error) {
+		finished <- err
+	})
+	d.recvDone(nil)
+	cancel()
+	assert.Equal(t, codes.Canceled, status.Code(<-finished))
+	// 只结束一次
+	d.recvDone(io.EOF)
+	assert.Len(t, finished, 0)
+}
+
 func TestSkywalkingClientTestSuite(t *testing.T) {
 	r, w, _ := os.Pipe()
 	// 替换原有os.Stdout
@@ -92,6 +376,7 @@ func TestSkywalkingClientTestSuite(t *testing.T) {
 		InterceptorTestSuite: &grpc_testing.InterceptorTestSuite{
 			ClientOpts: []grpc.DialOption{
 				grpc.WithUnaryInterceptor(NewUnaryClientSkywalkingInterceptor(tracer)),
+				grpc.WithStreamInterceptor(NewStreamClientSkywalkingInterceptor(tracer)),
 			},
 		},
 	}
@@ -100,6 +385,10 @@ func TestSkywalkingClientTestSuite(t *testing.T) {
 	suite.Run(t, s)
 }
 
+func (c *SkywalkingClientTestSuite) TestNewStreamClientSkywalkingInterceptor() {
+	c.pingStream()
+}
+
 func (c *SkywalkingClientTestSuite) TestNewUnaryClientSkywalkingInterceptor() {
 	_, err := c.Client.Ping(c.SimpleCtx(), skyClientPing)
 	c.NoError(err)
@@ -132,6 +421,7 @@ func TestSkywalkingServerTestSuite(t *testing.T) {
 		InterceptorTestSuite: &grpc_testing.InterceptorTestSuite{
 			ServerOpts: []grpc.ServerOption{
 				grpc.UnaryInterceptor(NewUnaryServerSkywalkingInterceptor(tracer)),
+				grpc.StreamInterceptor(NewStreamServerSkywalkingInterceptor(tracer)),
 			},
 		},
 	}
@@ -140,6 +430,10 @@ func TestSkywalkingServerTestSuite(t *testing.T) {
 	suite.Run(t, s)
 }
 
+func (s *SkywalkingServerTestSuite) TestNewStreamServerSkywalkingInterceptor() {
+	s.pingStream()
+}
+
 func (s *SkywalkingServerTestSuite) TestNewUnaryServerSkywalkingInterceptor() {
 	_, err := s.Client.Ping(s.SimpleCtx(), skyServerPing)
 	s.NoError(err)
@@ -158,3 +452,138 @@ func (s *SkywalkingServerTestSuite) TestNewUnaryServerSkywalkingInterceptor() {
 	s.Len(o, 1)
 	s.Equal(o[0], "")
 }
+
+// pingStream 通过双向stream发送并接收消息
+func pingStream(ctx context.Context, s *suite.Suite, client pb_testproto.TestServiceClient) {
+	stream, err := client.PingStream(ctx)
+	s.NoError(err)
+	for i := 0; i < 3; i++ {
+		s.NoError(stream.Send(goodPing))
+		resp, err := stream.Recv()
+		s.NoError(err)
+		s.Equal(goodPing.Value, resp.Value)
+	}
+	s.NoError(stream.CloseSend())
+	_, err = stream.Recv()
+	s.Equal(io.EOF, err)
+}
+
+func (c *SkywalkingClientTestSuite) pingStream() {
+	pingStream(c.SimpleCtx(), &c.InterceptorTestSuite.Suite, c.Client)
+}
+
+func (s *SkywalkingServerTestSuite) pingStream() {
+	pingStream(s.SimpleCtx(), &s.InterceptorTestSuite.Suite, s.Client)
+}
+
+// spanRecorder 记录上报的span, 用于校验span类型
+type spanRecorder struct {
+	spans chan go2sky.ReportedSpan
+}
+
+func (r *spanRecorder) Boot(string, string, []go2sky.AgentConfigChangeWatcher) {}
+
+func (r *spanRecorder) Send(spans []go2sky.ReportedSpan) {
+	for _, span := range spans {
+		r.spans <- span
+	}
+}
+
+func (r *spanRecorder) Close() {}
+
+func TestUnaryClientSkywalkingExitSpan(t *testing.T) {
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 1)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+	cc, err := grpc.Dial("localhost:9090", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	interceptor := NewUnaryClientSkywalkingInterceptor(tracer)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user", "1")
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, ok := metadata.FromOutgoingContext(ctx)
+		assert.True(t, ok)
+		// 原有的metadata需要保留
+		assert.Equal(t, []string{"1"}, md.Get("x-user"))
+		assert.Len(t, md.Get(propagation.Header), 1)
+		return nil
+	}
+	err = interceptor(ctx, "/test/Ping", goodPing, goodPing, cc, invoker)
+	assert.NoError(t, err)
+
+	span := <-recorder.spans
+	assert.Equal(t, v3.SpanType_Exit, span.SpanType())
+	assert.Equal(t, "localhost:9090", span.Peer())
+}
+
+func TestStreamClientSkywalkingClientStreaming(t *testing.T) {
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 2)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+	cc, stop := dialUploadServer(t, grpc.WithStreamInterceptor(NewStreamClientSkywalkingInterceptor(tracer)))
+	defer stop()
+
+	_, err = upload(context.Background(), cc, 2)
+	assert.NoError(t, err)
+	span := <-recorder.spans
+	assert.Equal(t, v3.SpanType_Exit, span.SpanType())
+	assert.Equal(t, uploadMethod, span.OperationName())
+	assert.False(t, span.IsError())
+
+	// 调用方取消ctx时同样结束span
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := cc.NewStream(ctx, &uploadStreamDesc, uploadMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(goodPing))
+	cancel()
+	select {
+	case span = <-recorder.spans:
+		assert.True(t, span.IsError())
+	case <-time.After(time.Second):
+		t.Fatal("span of cancelled stream not reported")
+	}
+}
+
+func TestStreamSkywalkingLogMessages(t *testing.T) {
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 1)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+	limiter := NewPayloadLimiter(LimitPayloadSize(10))
+
+	// 默认不记录消息内容
+	cc, stop := dialUploadServer(t, grpc.WithStreamInterceptor(NewStreamClientSkywalkingInterceptor(tracer)))
+	_, err = upload(context.Background(), cc, 3)
+	assert.NoError(t, err)
+	stop()
+	assert.Empty(t, (<-recorder.spans).Logs())
+
+	// 请求和响应分别只记录前n条, 内容按PayloadLimiter截断
+	cc, stop = dialUploadServer(t, grpc.WithStreamInterceptor(
+		NewStreamClientSkywalkingInterceptor(tracer, WithLogMessages(2), WithPayloadLimiter(limiter))))
+	_, err = upload(context.Background(), cc, 3)
+	assert.NoError(t, err)
+	stop()
+	logs := (<-recorder.spans).Logs()
+	assert.Len(t, logs, 3)
+	for i, tag := range []string{ReqTag, ReqTag, RespTag} {
+		assert.Equal(t, tag, logs[i].Data[0].Key)
+		assert.Contains(t, logs[i].Data[0].Value, "...(truncated, ")
+	}
+
+	interceptor := NewStreamServerSkywalkingInterceptor(tracer, WithLogMessages(1), WithPayloadLimiter(limiter))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-user", "1"))
+	info := &grpc.StreamServerInfo{FullMethod: "/mwitkow.testproto.TestService/PingStream"}
+	err = interceptor(nil, &fakeServerStream{ctx: ctx}, info, func(srv interface{}, stream grpc.ServerStream) error {
+		for i := 0; i < 3; i++ {
+			_ = stream.RecvMsg(goodPing)
+			_ = stream.SendMsg(goodPing)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	logs = (<-recorder.spans).Logs()
+	assert.Len(t, logs, 2)
+	assert.Equal(t, ReqTag, logs[0].Data[0].Key)
+	assert.Equal(t, RespTag, logs[1].Data[0].Key)
+}
@@ -0,0 +1,238 @@
+package hutils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const defaultLoggerName = "default"
+
+var (
+	logLevelsMu sync.RWMutex
+	logLevels   = map[string][]zap.AtomicLevel{}
+)
+
+// RegisterLogLevel 注册可以在运行时修改的日志级别, Logger.Init会自动注册.
+// 同一个名称可以注册多个日志级别, 修改时会一起修改.
+func RegisterLogLevel(name string, level zap.AtomicLevel) {
+	logLevelsMu.Lock()
+	defer logLevelsMu.Unlock()
+	for _, registered := range logLevels[name] {
+		if registered == level {
+			return
+		}
+	}
+	logLevels[name] = append(logLevels[name], level)
+}
+
+// UnregisterLogLevel 取消注册日志级别, Logger重新Build或Close时会自动取消注册
+func UnregisterLogLevel(name string, level zap.AtomicLevel) {
+	logLevelsMu.Lock()
+	defer logLevelsMu.Unlock()
+	levels := logLevels[name]
+	for i, registered := range levels {
+		if registered == level {
+			levels = append(levels[:i:i], levels[i+1:]...)
+			break
+		}
+	}
+	if len(levels) == 0 {
+		delete(logLevels, name)
+		return
+	}
+	logLevels[name] = levels
+}
+
+// minLevel 同名的多个日志级别不同时返回最低的级别
+func minLevel(levels []zap.AtomicLevel) string {
+	lvl := levels[0].Level()
+	for _, level := range levels[1:] {
+		if level.Level() < lvl {
+			lvl = level.Level()
+		}
+	}
+	return lvl.String()
+}
+
+// GetLogLevels 获取日志级别, name为空时返回所有已注册的日志级别
+func GetLogLevels(name string) (map[string]string, error) {
+	logLevelsMu.RLock()
+	defer logLevelsMu.RUnlock()
+	if name != "" {
+		levels, ok := logLevels[name]
+		if !ok {
+			return nil, fmt.Errorf("logger %q not registered", name)
+		}
+		return map[string]string{name: minLevel(levels)}, nil
+	}
+	levels := make(map[string]string, len(logLevels))
+	for n, registered := range logLevels {
+		levels[n] = minLevel(registered)
+	}
+	return levels, nil
+}
+
+// SetLogLevel 修改日志级别, name为空时修改所有已注册的日志级别, 返回修改后的级别
+func SetLogLevel(name, level string) (map[string]string, error) {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, err
+	}
+	logLevelsMu.RLock()
+	if name != "" {
+		levels, ok := logLevels[name]
+		logLevelsMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("logger %q not registered", name)
+		}
+		for _, atomicLevel := range levels {
+			atomicLevel.SetLevel(lvl)
+		}
+		return GetLogLevels(name)
+	}
+	for _, levels := range logLevels {
+		for _, atomicLevel := range levels {
+			atomicLevel.SetLevel(lvl)
+		}
+	}
+	logLevelsMu.RUnlock()
+	return GetLogLevels("")
+}
+
+// logLevelRequest 修改日志级别的请求, name为空时修改所有日志级别
+type logLevelRequest struct {
+	Name  string `json:"name"`
+	Level string `json:"level"`
+}
+
+// NewLogLevelHandler 查询、修改日志级别的http.Handler.
+// GET ?name=xxx 查询日志级别; PUT {"name": "xxx", "level": "debug"} 修改日志级别, name为空时修改所有日志级别.
+func NewLogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			levels map[string]string
+			err    error
+		)
+		switch r.Method {
+		case http.MethodGet:
+			levels, err = GetLogLevels(r.URL.Query().Get("name"))
+		case http.MethodPut, http.MethodPost:
+			var req logLevelRequest
+			if err = json.NewDecoder(r.Body).Decode(&req); err == nil {
+				levels, err = SetLogLevel(req.Name, req.Level)
+			}
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(levels)
+	})
+}
+
+// LogLevelServiceName grpc日志级别管理服务名.
+// 请求和响应均为google.protobuf.Struct, 请求字段为name, level, 响应为{name: level}.
+const LogLevelServiceName = "hutils.LogLevel"
+
+// RegisterLogLevelServer 注册grpc日志级别管理服务, 提供GetLevels, SetLevel方法
+func RegisterLogLevelServer(s *grpc.Server) {
+	s.RegisterService(&logLevelServiceDesc, nil)
+}
+
+var logLevelServiceDesc = grpc.ServiceDesc{
+	ServiceName: LogLevelServiceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetLevels", Handler: logLevelHandler("GetLevels", func(req logLevelRequest) (map[string]string, error) {
+			return GetLogLevels(req.Name)
+		})},
+		{MethodName: "SetLevel", Handler: logLevelHandler("SetLevel", func(req logLevelRequest) (map[string]string, error) {
+			return SetLogLevel(req.Name, req.Level)
+		})},
+	},
+	Streams: []grpc.StreamDesc{},
+}
+
+func logLevelHandler(method string, f func(req logLevelRequest) (map[string]string, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	call := func(ctx context.Context, in interface{}) (interface{}, error) {
+		fields := in.(*structpb.Struct).GetFields()
+		levels, err := f(logLevelRequest{
+			Name:  fields["name"].GetStringValue(),
+			Level: fields["level"].GetStringValue(),
+		})
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return levelsToStruct(levels), nil
+	}
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := &structpb.Struct{}
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + LogLevelServiceName + "/" + method}
+		return interceptor(ctx, in, info, call)
+	}
+}
+
+func levelsToStruct(levels map[string]string) *structpb.Struct {
+	out := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(levels))}
+	for name, level := range levels {
+		out.Fields[name] = structpb.NewStringValue(level)
+	}
+	return out
+}
+
+// LogLevelClient grpc日志级别管理服务客户端
+type LogLevelClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLogLevelClient(cc grpc.ClientConnInterface) *LogLevelClient {
+	return &LogLevelClient{cc: cc}
+}
+
+// GetLevels 查询日志级别, name为空时返回所有日志级别
+func (c *LogLevelClient) GetLevels(ctx context.Context, name string, opts ...grpc.CallOption) (map[string]string, error) {
+	return c.invoke(ctx, "GetLevels", logLevelRequest{Name: name}, opts...)
+}
+
+// SetLevel 修改日志级别, name为空时修改所有日志级别
+func (c *LogLevelClient) SetLevel(ctx context.Context, name, level string, opts ...grpc.CallOption) (map[string]string, error) {
+	return c.invoke(ctx, "SetLevel", logLevelRequest{Name: name, Level: level}, opts...)
+}
+
+func (c *LogLevelClient) invoke(ctx context.Context, method string, req logLevelRequest, opts ...grpc.CallOption) (map[string]string, error) {
+	in := &structpb.Struct{Fields: map[string]*structpb.Value{
+		"name":  structpb.NewStringValue(req.Name),
+		"level": structpb.NewStringValue(req.Level),
+	}}
+	out := &structpb.Struct{}
+	if err := c.cc.Invoke(ctx, "/"+LogLevelServiceName+"/"+method, in, out, opts...); err != nil {
+		return nil, err
+	}
+	levels := make(map[string]string, len(out.GetFields()))
+	for name, value := range out.GetFields() {
+		levels[name] = value.GetStringValue()
+	}
+	return levels, nil
+}
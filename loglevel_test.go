@@ -0,0 +1,146 @@
+package hutils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestLoggerLevel(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true, Name: "TestLoggerLevel"}).Sugar()
+		sugarLog.Debug("hidden")
+		logger.Level().SetLevel(zapcore.DebugLevel)
+		sugarLog.Debug("debug")
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, strings.Join(output, "\n"), "hidden")
+	assert.Contains(t, strings.Join(output, "\n"), "debug")
+
+	warn := zapcore.WarnLevel
+	output, err = CaptureStdout(func() {
+		logger := &Logger{Type: UNION}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true, IsUnion: true, MinLevel: &warn}).Sugar()
+		sugarLog.Info("info")
+		// union模式下Warn使用Info的encoder输出
+		sugarLog.Warn("warn")
+		sugarLog.Error("error")
+	})
+	assert.NoError(t, err)
+	logs := strings.Join(output, "\n")
+	assert.NotContains(t, logs, "info")
+	assert.Equal(t, 1, strings.Count(logs, "WARN"))
+	assert.Equal(t, 1, strings.Count(logs, "ERROR"))
+}
+
+func TestSetLogLevel(t *testing.T) {
+	logger := &Logger{}
+	logger.Init(LoggerOpt{Name: "TestSetLogLevel"})
+	levels, err := SetLogLevel("TestSetLogLevel", "debug")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"TestSetLogLevel": "debug"}, levels)
+	assert.Equal(t, zapcore.DebugLevel, logger.Level().Level())
+
+	_, err = SetLogLevel("TestSetLogLevel", "verbose")
+	assert.Error(t, err)
+	_, err = GetLogLevels("unregistered")
+	assert.Error(t, err)
+}
+
+func TestSetLogLevelSameName(t *testing.T) {
+	info, errorLogger := &Logger{}, &Logger{Type: ERROR}
+	info.Init(LoggerOpt{Name: "TestSetLogLevelSameName"})
+	errorLogger.Init(LoggerOpt{Name: "TestSetLogLevelSameName"})
+	// 同名的logger不会互相覆盖
+	levels, err := SetLogLevel("TestSetLogLevelSameName", "warn")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"TestSetLogLevelSameName": "warn"}, levels)
+	assert.Equal(t, zapcore.WarnLevel, info.Level().Level())
+	assert.Equal(t, zapcore.WarnLevel, errorLogger.Level().Level())
+
+	info.Level().SetLevel(zapcore.DebugLevel)
+	levels, err = GetLogLevels("TestSetLogLevelSameName")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"TestSetLogLevelSameName": "debug"}, levels)
+
+	// 重新Build时替换之前的日志级别, 不再修改旧的logger
+	oldLevel := info.Level()
+	info.Init(LoggerOpt{Name: "TestSetLogLevelSameName"})
+	info.Init(LoggerOpt{Name: "TestSetLogLevelSameName"})
+	assert.Len(t, logLevels["TestSetLogLevelSameName"], 2)
+	_, err = SetLogLevel("TestSetLogLevelSameName", "error")
+	assert.NoError(t, err)
+	assert.Equal(t, zapcore.DebugLevel, oldLevel.Level())
+	assert.Equal(t, zapcore.ErrorLevel, info.Level().Level())
+
+	// Close时取消注册
+	assert.NoError(t, info.Close())
+	assert.Len(t, logLevels["TestSetLogLevelSameName"], 1)
+	assert.NoError(t, errorLogger.Close())
+	_, err = GetLogLevels("TestSetLogLevelSameName")
+	assert.Error(t, err)
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	logger := &Logger{}
+	logger.Init(LoggerOpt{Name: "TestLogLevelHandler"})
+	h := NewLogLevelHandler()
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("PUT", "/log/level", strings.NewReader(`{"name":"TestLogLevelHandler","level":"warn"}`)))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.JSONEq(t, `{"TestLogLevelHandler":"warn"}`, rw.Body.String())
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("GET", "/log/level?name=TestLogLevelHandler", nil))
+	assert.JSONEq(t, `{"TestLogLevelHandler":"warn"}`, rw.Body.String())
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("PUT", "/log/level", strings.NewReader(`{"level":"verbose"}`)))
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+
+	rw = httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest("DELETE", "/log/level", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rw.Code)
+}
+
+func TestLogLevelServer(t *testing.T) {
+	logger := &Logger{}
+	logger.Init(LoggerOpt{Name: "TestLogLevelServer"})
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	RegisterLogLevelServer(server)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	cc, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	client := NewLogLevelClient(cc)
+	levels, err := client.SetLevel(context.Background(), "TestLogLevelServer", "error")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"TestLogLevelServer": "error"}, levels)
+	assert.Equal(t, zapcore.ErrorLevel, logger.Level().Level())
+
+	levels, err = client.GetLevels(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "error", levels["TestLogLevelServer"])
+
+	_, err = client.GetLevels(context.Background(), "unregistered")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
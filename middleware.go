@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/SkyAPM/go2sky"
+	"go.uber.org/zap"
 	v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
 
@@ -27,24 +30,17 @@ type handler struct {
 	name       string
 	tracer     *go2sky.Tracer
 	extraTags  map[string]string
+	redactor   *Redactor
+	// limit payloads of span logs.
+	payloadLimiter *PayloadLimiter
+	// proxies allowed to set X-Forwarded-For/X-Real-IP.
+	trustedProxies []*net.IPNet
+	// log recovered panics.
+	logger *zap.SugaredLogger
 	// get operation name.
 	operationFunc operation
 }
 
-// responseWriter is a minimal wrapper for http.ResponseWriter that allows the
-// written HTTP status code to be captured for logging.
-// nolint: govet,unused
-type responseWriter struct {
-	http.ResponseWriter
-	status      int
-	wroteHeader bool
-	body        []byte
-}
-
-func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
-	return &responseWriter{ResponseWriter: w}
-}
-
 func WithFilterURL(urls []string) func(*handler) {
 	return func(options *handler) {
 		options.filterURLs = urls
@@ -57,6 +53,48 @@ func WithOperation(operation operation) func(*handler) {
 	}
 }
 
+// WithHTTPRedactor 记录span前对请求参数、响应结果脱敏
+func WithHTTPRedactor(redactor *Redactor) func(*handler) {
+	return func(options *handler) {
+		options.redactor = redactor
+	}
+}
+
+// WithHTTPPayloadLimiter 限制span中请求参数、响应结果的记录
+func WithHTTPPayloadLimiter(limiter *PayloadLimiter) func(*handler) {
+	return func(options *handler) {
+		options.payloadLimiter = limiter
+	}
+}
+
+// WithTrustedProxies 可信代理的ip或网段, 只有请求来自可信代理时才使用X-Forwarded-For/X-Real-IP中的客户端ip
+func WithTrustedProxies(proxies []string) func(*handler) {
+	return func(options *handler) {
+		for _, proxy := range proxies {
+			if !strings.Contains(proxy, "/") {
+				if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+					proxy += "/32"
+				} else {
+					proxy += "/128"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(proxy)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			options.trustedProxies = append(options.trustedProxies, ipNet)
+		}
+	}
+}
+
+// WithHTTPLogger 记录中间件捕获的panic
+func WithHTTPLogger(logger *zap.SugaredLogger) func(*handler) {
+	return func(options *handler) {
+		options.logger = logger
+	}
+}
+
 func WithExtraTags(tags map[string]string) func(*handler) {
 	return func(options *handler) {
 		options.extraTags = tags
@@ -102,45 +140,186 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	})
 	if err != nil {
 		if h.next != nil {
-			h.next.ServeHTTP(w, r)
+			rw := wrapResponseWriter(w, 0)
+			defer h.recoverPanic(rw, r)
+			h.next.ServeHTTP(rw.writer(), r)
 		}
 		return
 	}
-	payload, err := io.ReadAll(r.Body)
-	if err != nil {
-		log.Println(err)
-	}
-
 	span.SetComponent(ComponentIDGOHttpServer)
 	span.Tag(go2sky.TagHTTPMethod, r.Method)
 	span.Tag(go2sky.TagURL, fmt.Sprintf("%s%s", r.Host, r.URL.Path))
 	span.SetSpanLayer(v3.SpanLayer_Http)
-	span.Log(time.Now(), ReqTag, Param(payload))
 	for k, v := range h.extraTags {
 		span.Tag(go2sky.Tag(k), v)
 	}
 
-	r.Body = io.NopCloser(bytes.NewBuffer(payload))
-	rw := wrapResponseWriter(w)
+	logPayload := !h.payloadLimiter.SkipMethod(r.Method, r.URL.Path) && h.payloadLimiter.Sampled()
+	if logPayload && !h.payloadLimiter.SkipContentType(r.Header.Get("Content-Type")) {
+		span.Log(time.Now(), ReqTag, Param(h.readRequestBody(r)))
+	}
+	rw := wrapResponseWriter(w, 0)
+	if logPayload {
+		rw.maxBody = MaxCaptureBodySize
+	}
 	defer func() {
 		if e := recover(); e != nil {
 			span.Error(time.Now(), RespTag, MarshalParam(e))
-			span.Tag(go2sky.TagStatusCode, strconv.Itoa(500))
+			span.Tag(go2sky.TagStatusCode, strconv.Itoa(http.StatusInternalServerError))
 			span.End()
-			panic(e)
+			if e == http.ErrAbortHandler {
+				panic(e)
+			}
+			recoverHTTP(rw, r, h.logger, e)
 		} else {
-			if rw.status >= 400 {
-				span.Error(time.Now(), RespTag, string(rw.body))
-			} else {
-				span.Log(time.Now(), RespTag, string(rw.body))
+			var body string
+			if logPayload && !h.payloadLimiter.SkipContentType(rw.Header().Get("Content-Type")) {
+				body = string(h.payloadLimiter.truncate(h.redactor.redactPayload(rw.body), rw.size))
+			}
+			if rw.Status() >= 400 {
+				span.Error(time.Now(), RespTag, body)
+			} else if body != "" {
+				span.Log(time.Now(), RespTag, body)
 			}
-			span.Tag(go2sky.TagStatusCode, strconv.Itoa(rw.status))
+			span.Tag(go2sky.TagStatusCode, strconv.Itoa(rw.Status()))
 			span.End()
 		}
 	}()
 	if h.next != nil {
-		h.next.ServeHTTP(rw, r.WithContext(ctx))
+		h.next.ServeHTTP(rw.writer(), r.WithContext(ctx))
+	}
+}
+
+// ClientIPFromRequest 获取http请求的客户端ip, 只有直连地址为可信代理时才使用X-Forwarded-For/X-Real-IP
+func ClientIPFromRequest(r *http.Request, trustedProxies []*net.IPNet) string {
+	remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remoteIP = r.RemoteAddr
+	}
+	if !isTrustedProxy(remoteIP, trustedProxies) {
+		return remoteIP
+	}
+	// 从右往左跳过可信代理, 第一个不可信的地址即为客户端ip
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(forwarded[i])
+		if ip == "" {
+			continue
+		}
+		if !isTrustedProxy(ip, trustedProxies) {
+			return ip
+		}
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return remoteIP
+}
+
+func isTrustedProxy(ip string, trustedProxies []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessLogHandler 记录http访问日志, 复用handler的配置
+type accessLogHandler struct {
+	handler
+	logger *zap.SugaredLogger
+}
+
+// NewHTTPAccessLogMiddleware 记录http访问日志, 每个请求输出一条UnionLog.
+// 支持WithFilterURL, WithHTTPRedactor, WithHTTPPayloadLimiter, WithTrustedProxies.
+func NewHTTPAccessLogMiddleware(logger *zap.SugaredLogger, opts ...func(*handler)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := &accessLogHandler{
+			handler: handler{next: next},
+			logger:  logger,
+		}
+		for _, o := range opts {
+			o(&h.handler)
+		}
+		return h
+	}
+}
+
+func (h *accessLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if FilterURL(h.filterURLs, r.URL.Path) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	startTime := time.Now()
+	l := UnionLog{
+		ClientIP: ClientIPFromRequest(r, h.trustedProxies),
+		Method:   r.Method,
+		Request:  redactRequestURI(r, h.redactor),
+		Protocol: r.Proto,
+		Agent:    r.UserAgent(),
+		LogType:  defaultLogType,
+	}
+	logPayload := !h.payloadLimiter.SkipMethod(r.Method, r.URL.Path) && h.payloadLimiter.Sampled()
+	if logPayload && !h.payloadLimiter.SkipContentType(r.Header.Get("Content-Type")) {
+		l.Payload = h.readRequestBody(r)
+	}
+	rw := wrapResponseWriter(w, 0)
+	if logPayload {
+		rw.maxBody = MaxCaptureBodySize
+	}
+	// handler panic时同样记录访问日志, 状态码为500, panic交给外层处理
+	defer func() {
+		p := recover()
+		l.Duration = time.Since(startTime).Milliseconds()
+		l.StatusCode = rw.Status()
+		if p != nil {
+			l.StatusCode = http.StatusInternalServerError
+		}
+		if logPayload && !h.payloadLimiter.SkipContentType(rw.Header().Get("Content-Type")) {
+			l.Response = h.payloadLimiter.truncate(h.redactor.redactPayload(rw.body), rw.size)
+		}
+		l.Log(r.Context(), h.logger)
+		if p != nil {
+			panic(p)
+		}
+	}()
+	ctx := withRequestLogger(r.Context(), h.logger, "method", r.Method, "request", r.URL.Path, "client_ip", l.ClientIP)
+	h.next.ServeHTTP(rw.writer(), r.WithContext(ctx))
+}
+
+// readRequestBody 预读最多MaxCaptureBodySize字节的请求内容用于记录, 并还原r.Body.
+// 先对读取的完整内容脱敏再截断, 超出MaxCaptureBodySize的部分不会被记录.
+func (h handler) readRequestBody(r *http.Request) []byte {
+	buf, err := io.ReadAll(io.LimitReader(r.Body, int64(MaxCaptureBodySize)+1))
+	if err != nil {
+		log.Println(err)
+	}
+	r.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(buf), r.Body), Closer: r.Body}
+	size := len(buf)
+	if r.ContentLength > int64(size) {
+		size = int(r.ContentLength)
+	}
+	if len(buf) > MaxCaptureBodySize {
+		buf = buf[:MaxCaptureBodySize]
+	}
+	return h.payloadLimiter.truncate(h.redactor.redactPayload(buf), size)
+}
+
+// redactRequestURI 请求的path和脱敏后的query
+func redactRequestURI(r *http.Request, redactor *Redactor) string {
+	uri := r.URL.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	if r.URL.RawQuery != "" {
+		uri += "?" + redactor.RedactQuery(r.URL.RawQuery)
 	}
+	return uri
 }
 
 func Param(param []byte) string {
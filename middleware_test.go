@@ -1,12 +1,15 @@
 package hutils
 
 import (
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/SkyAPM/go2sky"
 	"github.com/SkyAPM/go2sky/reporter"
+	"github.com/stretchr/testify/assert"
 )
 
 type Ping struct{}
@@ -40,3 +43,154 @@ func TestSkywalkingHTTPMiddlewareTestSuite(t *testing.T) {
 func (p *Ping) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
+
+func TestHTTPAccessLogMiddleware(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		middleware := NewHTTPAccessLogMiddleware(sugarLog,
+			WithFilterURL([]string{"/health"}),
+			WithTrustedProxies([]string{"10.0.0.0/8"}),
+		)
+		mux := http.NewServeMux()
+		mux.Handle("/ping", middleware(&Ping{}))
+		mux.Handle("/health", middleware(&Ping{}))
+
+		req := httptest.NewRequest("POST", "/ping?a=1", strings.NewReader(`{"value":"ping"}`))
+		req.RemoteAddr = "10.0.0.1:12345"
+		req.Header.Set("X-Forwarded-For", "1.2.3.4, 10.0.0.2")
+		req.Header.Set("User-Agent", "hutils-test")
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	})
+	assert.NoError(t, err)
+	// 健康检查不记录日志
+	assert.Len(t, output, 2)
+	assert.Contains(t, output[0], `"client_ip": "1.2.3.4"`)
+	assert.Contains(t, output[0], `"request": "/ping?a=1"`)
+	assert.Contains(t, output[0], `"agent": "hutils-test"`)
+	assert.Contains(t, output[0], `"status_code": 200`)
+	assert.Contains(t, output[0], `"response": "OK"`)
+	assert.Contains(t, output[0], `"log_type": "http"`)
+}
+
+func TestHTTPAccessLogMiddlewarePanic(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		sugarLog := (&Logger{}).Init(LoggerOpt{EnableStdout: true}).Sugar()
+		handler := NewHTTPAccessLogMiddleware(sugarLog)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		// panic交给外层处理
+		assert.PanicsWithValue(t, "boom", func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ping", nil))
+		})
+	})
+	assert.NoError(t, err)
+	assert.Len(t, output, 2)
+	assert.Contains(t, output[0], `"request": "/ping"`)
+	assert.Contains(t, output[0], `"status_code": 500`)
+}
+
+func TestHTTPAccessLogRedactQueryAndLimitBody(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	output, err := CaptureStdout(func() {
+		sugarLog := (&Logger{}).Init(LoggerOpt{EnableStdout: true}).Sugar()
+		middleware := NewHTTPAccessLogMiddleware(sugarLog,
+			WithHTTPRedactor(NewRedactor(RedactField("access_token", MaskAll))),
+			WithHTTPPayloadLimiter(NewPayloadLimiter(LimitPayloadSize(10))),
+		)
+		handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// 处理请求时仍能读取完整内容
+			b, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, body, string(b))
+		}))
+		req := httptest.NewRequest("POST", "/ping?a=1&accessToken=secret", strings.NewReader(body))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, output, 2)
+	assert.Contains(t, output[0], `"request": "/ping?a=1&accessToken=******"`)
+	assert.NotContains(t, output[0], "secret")
+	assert.Contains(t, output[0], `"payload": "xxxxxxxxxx...(truncated, 100 bytes)"`)
+}
+
+func TestHTTPAccessLogRedactOversizedBody(t *testing.T) {
+	body := `{"remark":"` + strings.Repeat("x", 50) + `","phone":"13812345678"}`
+	output, err := CaptureStdout(func() {
+		sugarLog := (&Logger{}).Init(LoggerOpt{EnableStdout: true}).Sugar()
+		middleware := NewHTTPAccessLogMiddleware(sugarLog,
+			WithHTTPRedactor(NewRedactor(RedactField("phone", MaskKeepLast4))),
+			WithHTTPPayloadLimiter(NewPayloadLimiter(LimitPayloadSize(40))),
+		)
+		handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, body, string(b))
+			w.Write(b)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/ping", strings.NewReader(body)))
+
+		// 超出MaxCaptureBodySize的json无法解析, 不记录原内容
+		defer func(size int) { MaxCaptureBodySize = size }(MaxCaptureBodySize)
+		MaxCaptureBodySize = 80
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/ping", strings.NewReader(body)))
+	})
+	assert.NoError(t, err)
+	assert.Len(t, output, 3)
+	for _, line := range output[:2] {
+		assert.NotContains(t, line, "13812345678")
+	}
+	assert.Contains(t, output[0], `"payload": "{\"phone\":\"*******5678\",\"remark\":\"xxxxxxx...(truncated, 85 bytes)"`)
+	assert.Contains(t, output[1], `"payload": "<redacted: unparseable>...(truncated, 85 bytes)"`)
+	assert.Contains(t, output[1], `"response": "<redacted: unparseable>...(truncated, 85 bytes)"`)
+}
+
+func TestSkywalkingHTTPMiddlewareRedactOversizedBody(t *testing.T) {
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 1)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+	middleware, err := NewServerSkywalkingHTTPMiddleware(tracer,
+		WithOperation(func(name string, r *http.Request) string { return r.URL.Path }),
+		WithHTTPRedactor(NewRedactor(RedactField("phone", MaskAll))),
+		WithHTTPPayloadLimiter(NewPayloadLimiter(LimitPayloadSize(40))),
+	)
+	assert.NoError(t, err)
+	body := `{"remark":"` + strings.Repeat("x", 50) + `","phone":"13812345678"}`
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/ping", strings.NewReader(body)))
+
+	span := <-recorder.spans
+	logs := span.Logs()
+	assert.Len(t, logs, 2)
+	for _, l := range logs {
+		assert.NotContains(t, l.Data[0].Value, "13812345678")
+	}
+}
+
+func TestClientIPFromRequest(t *testing.T) {
+	h := &handler{}
+	WithTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})(h)
+	cases := []struct {
+		remoteAddr, forwarded, realIP, expected string
+	}{
+		{"1.1.1.1:80", "2.2.2.2", "", "1.1.1.1"},
+		{"10.0.0.1:80", "2.2.2.2, 192.168.1.1", "", "2.2.2.2"},
+		{"10.0.0.1:80", "", "3.3.3.3", "3.3.3.3"},
+		{"192.168.1.1:80", "10.0.0.3", "", "192.168.1.1"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		if c.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if c.realIP != "" {
+			req.Header.Set("X-Real-IP", c.realIP)
+		}
+		assert.Equal(t, c.expected, ClientIPFromRequest(req, h.trustedProxies))
+	}
+}
@@ -0,0 +1,266 @@
+package hutils
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	grpc_logging "github.com/grpc-ecosystem/go-grpc-middleware/logging"
+	"go.elastic.co/apm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const otelInstrumentationName = "github.com/zaihui/go-hutils"
+
+var (
+	otelOnce     sync.Once
+	otelProvider *sdktrace.TracerProvider
+)
+
+// InitTracerProvider 创建TracerProvider并设置为otel全局TracerProvider, 同时设置W3C traceparent/baggage propagator,
+// 只有第一次调用生效, 需要通过sdktrace.WithBatcher等配置exporter.
+// 拦截器和中间件只使用otel.GetTracerProvider和otel.GetTextMapPropagator, 不会修改全局配置,
+// 应用已自行设置全局TracerProvider和propagator时不需要调用, 两者都没有时otel为no-op, 日志中不会有otel的trace id.
+func InitTracerProvider(opts ...sdktrace.TracerProviderOption) *sdktrace.TracerProvider {
+	otelOnce.Do(func() {
+		opts = append([]sdktrace.TracerProviderOption{
+			sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(serviceName))),
+		}, opts...)
+		otelProvider = sdktrace.NewTracerProvider(opts...)
+		otel.SetTracerProvider(otelProvider)
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	})
+	return otelProvider
+}
+
+func otelTracer() trace.Tracer {
+	return otel.GetTracerProvider().Tracer(otelInstrumentationName)
+}
+
+// metadataCarrier 将grpc metadata适配为propagation.TextMapCarrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return strings.Join(metadata.MD(c).Get(key), ",")
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// grpcSpanAttributes 按语义约定生成grpc span属性
+func grpcSpanAttributes(fullMethod string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.RPCSystemKey.String("grpc")}
+	name := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		attrs = append(attrs, semconv.RPCServiceKey.String(name[:i]), semconv.RPCMethodKey.String(name[i+1:]))
+	}
+	return attrs
+}
+
+// endGrpcSpan 记录grpc状态并结束span
+func endGrpcSpan(span trace.Span, err error) {
+	code := grpc_logging.DefaultErrorToCode(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	if code != codes.OK {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startGrpcServerTrace 从grpc metadata中提取上游trace, 开始覆盖整个请求处理的server span和APM transaction.
+// ctx中已有span时(如已使用NewUnaryServerOtelInterceptor)不会重复创建span.
+func startGrpcServerTrace(ctx context.Context, fullMethod string, apmTracer *apm.Tracer) (context.Context, func(err error)) {
+	end := func(err error) {}
+	if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		var span trace.Span
+		ctx, span = startGrpcServerSpan(ctx, fullMethod)
+		end = func(err error) {
+			endGrpcSpan(span, err)
+		}
+	}
+	if apmTracer != nil {
+		tx := apmTracer.StartTransaction(fullMethod, "grpc")
+		ctx = apm.ContextWithTransaction(ctx, tx)
+		endSpan := end
+		end = func(err error) {
+			tx.Result = grpc_logging.DefaultErrorToCode(err).String()
+			tx.End()
+			endSpan(err)
+		}
+	}
+	return ctx, end
+}
+
+func startGrpcServerSpan(ctx context.Context, fullMethod string) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	attrs := grpcSpanAttributes(fullMethod)
+	if ip := ClientIPFromContext(ctx); ip != "" {
+		attrs = append(attrs, semconv.NetPeerIPKey.String(ip))
+	}
+	return otelTracer().Start(ctx, fullMethod, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// NewUnaryServerOtelInterceptor OpenTelemetry server interceptor, span覆盖整个请求处理, 并记录grpc状态.
+func NewUnaryServerOtelInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if FilterMethod(options.filterMethods, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, span := startGrpcServerSpan(ctx, info.FullMethod)
+		defer func() {
+			endGrpcSpan(span, err)
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// NewStreamServerOtelInterceptor OpenTelemetry stream server interceptor.
+func NewStreamServerOtelInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	options := newOptions(opts...)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		if FilterMethod(options.filterMethods, info.FullMethod) {
+			return handler(srv, stream)
+		}
+		ctx, span := startGrpcServerSpan(stream.Context(), info.FullMethod)
+		defer func() {
+			endGrpcSpan(span, err)
+		}()
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = ctx
+		return handler(srv, wrapped)
+	}
+}
+
+// startGrpcClientSpan 开始client span, 并将traceparent/baggage注入到outgoing metadata
+func startGrpcClientSpan(ctx context.Context, fullMethod, target string) (context.Context, trace.Span) {
+	attrs := append(grpcSpanAttributes(fullMethod), semconv.NetPeerNameKey.String(target))
+	ctx, span := otelTracer().Start(ctx, fullMethod, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	md := outgoingMetadata(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md), span
+}
+
+// NewUnaryClientOtelInterceptor OpenTelemetry client interceptor, 向下游传递W3C traceparent/baggage.
+func NewUnaryClientOtelInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		if FilterMethod(options.filterMethods, method) {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		ctx, span := startGrpcClientSpan(ctx, method, cc.Target())
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		endGrpcSpan(span, err)
+		return err
+	}
+}
+
+// NewStreamClientOtelInterceptor OpenTelemetry stream client interceptor, span在stream结束时关闭.
+func NewStreamClientOtelInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if FilterMethod(options.filterMethods, method) {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+		ctx, span := startGrpcClientSpan(ctx, method, cc.Target())
+		stream, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			endGrpcSpan(span, err)
+			return nil, err
+		}
+		s := &otelClientStream{ClientStream: stream}
+		s.clientStreamDone = newClientStreamDone(ctx, desc, func(err error) {
+			endGrpcSpan(span, err)
+		})
+		return s, nil
+	}
+}
+
+// otelClientStream stream结束时关闭span
+type otelClientStream struct {
+	grpc.ClientStream
+	*clientStreamDone
+}
+
+func (s *otelClientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	s.sendDone(err)
+	return err
+}
+
+func (s *otelClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.recvDone(err)
+	return err
+}
+
+// NewServerOtelHTTPMiddleware OpenTelemetry http中间件, 从header中提取W3C traceparent/baggage, span覆盖整个请求处理.
+// 支持WithFilterURL, WithOperation, WithExtraTags.
+func NewServerOtelHTTPMiddleware(opts ...func(*handler)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		h := &otelHandler{
+			handler: handler{
+				next: next,
+				operationFunc: func(name string, r *http.Request) string {
+					if name != "" {
+						return name
+					}
+					return r.Method + " " + r.URL.Path
+				},
+			},
+		}
+		for _, o := range opts {
+			o(&h.handler)
+		}
+		return h
+	}
+}
+
+// otelHandler OpenTelemetry http中间件, 复用handler的配置
+type otelHandler struct {
+	handler
+}
+
+func (h *otelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if FilterURL(h.filterURLs, r.URL.Path) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	attrs := semconv.HTTPServerAttributesFromHTTPRequest(serviceName, "", r)
+	attrs = append(attrs, semconv.NetAttributesFromHTTPRequest("tcp", r)...)
+	for k, v := range h.extraTags {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	ctx, span := otelTracer().Start(ctx, h.operationFunc(h.name, r),
+		trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	defer span.End()
+
+	rw := wrapResponseWriter(w, 0)
+	h.next.ServeHTTP(rw.writer(), r.WithContext(ctx))
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(rw.Status()))
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(rw.Status(), trace.SpanKindServer))
+}
@@ -0,0 +1,126 @@
+package hutils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testTraceParent = "00-744ba40615ac6737263c10f1255eac36-a221978841e89dac-01"
+	testTraceID     = "744ba40615ac6737263c10f1255eac36"
+)
+
+func newSpanRecorder() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	InitTracerProvider().RegisterSpanProcessor(recorder)
+	return recorder
+}
+
+func TestUnaryServerOtelInterceptor(t *testing.T) {
+	recorder := newSpanRecorder()
+	defer InitTracerProvider().UnregisterSpanProcessor(recorder)
+
+	interceptor := NewUnaryServerOtelInterceptor()
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", testTraceParent))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Ping"}
+	_, err := interceptor(ctx, goodPing, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		// span覆盖整个请求处理, 并延续上游trace
+		assert.Equal(t, testTraceID, TraceIDFromContext(ctx))
+		assert.True(t, trace.SpanFromContext(ctx).IsRecording())
+		return nil, status.Error(codes.NotFound, "not found")
+	})
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+	assert.Equal(t, testTraceID, spans[0].Parent().TraceID().String())
+	assert.Equal(t, otelcodes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), semconv.RPCGRPCStatusCodeKey.Int(int(codes.NotFound)))
+	assert.Contains(t, spans[0].Attributes(), semconv.RPCMethodKey.String("Ping"))
+}
+
+func TestUnaryClientOtelInterceptor(t *testing.T) {
+	recorder := newSpanRecorder()
+	defer InitTracerProvider().UnregisterSpanProcessor(recorder)
+	cc, err := grpc.Dial("localhost:9090", grpc.WithInsecure())
+	assert.NoError(t, err)
+	defer cc.Close()
+
+	interceptor := NewUnaryClientOtelInterceptor()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-user", "1")
+	err = interceptor(ctx, "/test.Service/Ping", goodPing, goodPing, cc,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			assert.Equal(t, []string{"1"}, md.Get("x-user"))
+			assert.Len(t, md.Get("traceparent"), 1)
+			return nil
+		})
+	assert.NoError(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Equal(t, otelcodes.Unset, spans[0].Status().Code)
+}
+
+func TestServerOtelHTTPMiddleware(t *testing.T) {
+	recorder := newSpanRecorder()
+	defer InitTracerProvider().UnregisterSpanProcessor(recorder)
+
+	middleware := NewServerOtelHTTPMiddleware(WithFilterURL([]string{"/health"}))
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ping" {
+			assert.Equal(t, testTraceID, TraceIDFromContext(r.Context()))
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set("traceparent", testTraceParent)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /ping", spans[0].Name())
+	assert.Equal(t, otelcodes.Error, spans[0].Status().Code)
+	assert.Contains(t, spans[0].Attributes(), semconv.HTTPStatusCodeKey.Int(http.StatusInternalServerError))
+}
+
+func TestStreamClientOtelClientStreaming(t *testing.T) {
+	recorder := newSpanRecorder()
+	defer InitTracerProvider().UnregisterSpanProcessor(recorder)
+	cc, stop := dialUploadServer(t, grpc.WithStreamInterceptor(NewStreamClientOtelInterceptor()))
+	defer stop()
+
+	_, err := upload(context.Background(), cc, 2)
+	assert.NoError(t, err)
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, uploadMethod, spans[0].Name())
+	assert.Equal(t, otelcodes.Unset, spans[0].Status().Code)
+
+	// 调用方取消ctx时同样结束span
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := cc.NewStream(ctx, &uploadStreamDesc, uploadMethod)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.SendMsg(goodPing))
+	cancel()
+	assert.Eventually(t, func() bool {
+		return len(recorder.Ended()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, recorder.Ended()[1].Attributes(), semconv.RPCGRPCStatusCodeKey.Int(int(codes.Canceled)))
+}
@@ -0,0 +1,443 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	hutils "github.com/zaihui/go-hutils"
+)
+
+const (
+	schemaVersionKey  = "schema_version"
+	accessLogMessage  = "access"
+	requestLogMessage = "request"
+)
+
+// ErrFormat 日志内容不是对应的格式
+var ErrFormat = errors.New("parser: unexpected log format")
+
+// Kind 日志记录的类型
+type Kind string
+
+const (
+	KindAccess  Kind = "access"
+	KindRequest Kind = "request"
+	KindUnion   Kind = "union"
+	KindTrack   Kind = "track"
+	KindLog     Kind = "log"
+)
+
+// AccessRecord AccessLog及日志中额外记录的服务名, trace信息
+type AccessRecord struct {
+	hutils.AccessLog
+	Service string
+	TraceID string
+	SpanID  string
+}
+
+// RequestRecord RequestLog及日志中额外记录的服务名, trace信息
+type RequestRecord struct {
+	hutils.RequestLog
+	Service string
+	TraceID string
+	SpanID  string
+}
+
+var (
+	// 访问日志agent之后为" service $"
+	agentEnd = regexp.MustCompile(`" (\S*) \$"`)
+	// 旧版本RequestLog.Log参数顺序错误时的输出
+	buggyRequestHeader = regexp.MustCompile(`^(\S*) %!s\(int64=(-?\d+)\) %!d\(string=(\S*)\) `)
+	buggyRequestSuffix = " %!s(MISSING)"
+)
+
+// cursor 按单个空格切分旧格式日志, 字段可能为空
+type cursor struct {
+	s   string
+	err error
+}
+
+func (c *cursor) fail() {
+	if c.err == nil {
+		c.err = ErrFormat
+	}
+}
+
+// word 读取到下一个空格
+func (c *cursor) word() string {
+	if c.err != nil {
+		return ""
+	}
+	i := strings.IndexByte(c.s, ' ')
+	if i < 0 {
+		w := c.s
+		c.s = ""
+		return w
+	}
+	w := c.s[:i]
+	c.s = c.s[i+1:]
+	return w
+}
+
+// quoted 读取$%q$格式的内容
+func (c *cursor) quoted() []byte {
+	if c.err != nil {
+		return nil
+	}
+	if !strings.HasPrefix(c.s, `$"`) {
+		c.fail()
+		return nil
+	}
+	q, err := strconv.QuotedPrefix(c.s[1:])
+	if err != nil || !strings.HasPrefix(c.s[1+len(q):], "$") {
+		c.fail()
+		return nil
+	}
+	v, err := strconv.Unquote(q)
+	if err != nil {
+		c.fail()
+		return nil
+	}
+	c.s = c.s[2+len(q):]
+	if strings.HasPrefix(c.s, " ") {
+		c.s = c.s[1:]
+	}
+	return []byte(v)
+}
+
+func (c *cursor) int64() int64 {
+	w := c.word()
+	if c.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseInt(w, 10, 64)
+	if err != nil {
+		c.fail()
+	}
+	return v
+}
+
+// ParseAccessLog 解析AccessLog.Log, AccessLog.LogWithContext的旧格式
+func ParseAccessLog(message string) (*AccessRecord, error) {
+	c := &cursor{s: message}
+	r := &AccessRecord{}
+	r.ClientIP = c.word()
+	r.Method = c.word()
+	r.Request = c.word()
+	r.Payload = c.quoted()
+	r.Protocol = c.word()
+	r.StatusCode = int(c.int64())
+	r.Duration = c.int64()
+	if c.err != nil || !strings.HasPrefix(c.s, `"`) {
+		return nil, ErrFormat
+	}
+	// agent没有转义, 以之后的" service $"确定结尾
+	loc := agentEnd.FindStringSubmatchIndex(c.s)
+	if loc == nil {
+		return nil, ErrFormat
+	}
+	r.Agent = c.s[1:loc[0]]
+	r.Service = c.s[loc[2]:loc[3]]
+	c.s = c.s[loc[3]+1:]
+	r.Response = c.quoted()
+	if c.err != nil {
+		return nil, c.err
+	}
+	rest := strings.Split(c.s, " ")
+	switch len(rest) {
+	case 4:
+		r.TraceID, r.SpanID = rest[2], rest[3]
+		fallthrough
+	case 2:
+		r.LogType, r.GrpcStatus = rest[0], rest[1]
+	default:
+		return nil, ErrFormat
+	}
+	return r, nil
+}
+
+// ParseRequestLog 解析RequestLog.Log, RequestLog.LogWithContext的旧格式, 包括旧版本参数顺序错误的输出
+func ParseRequestLog(message string) (*RequestRecord, error) {
+	if m := buggyRequestHeader.FindStringSubmatch(message); m != nil {
+		return parseBuggyRequestLog(message[len(m[0]):], m)
+	}
+	c := &cursor{s: message}
+	r := &RequestRecord{}
+	r.Method = c.word()
+	r.Duration = c.int64()
+	r.Request = c.word()
+	r.Payload = c.quoted()
+	if c.err != nil {
+		return nil, c.err
+	}
+	// 状态描述可能包含空格
+	i := strings.Index(c.s, ` $"`)
+	if i < 0 {
+		return nil, ErrFormat
+	}
+	r.StatusDescription = c.s[:i]
+	c.s = c.s[i+1:]
+	r.Response = c.quoted()
+	if c.err != nil {
+		return nil, c.err
+	}
+	rest := strings.Split(c.s, " ")
+	switch len(rest) {
+	case 3:
+		r.TraceID, r.SpanID = rest[1], rest[2]
+		fallthrough
+	case 1:
+		r.Service = rest[0]
+	default:
+		return nil, ErrFormat
+	}
+	return r, nil
+}
+
+// parseBuggyRequestLog "method %!s(int64=duration) %!d(string=request) payload $"status"$ response $"service"$ %!s(MISSING)"
+func parseBuggyRequestLog(rest string, header []string) (*RequestRecord, error) {
+	if !strings.HasSuffix(rest, buggyRequestSuffix) {
+		return nil, ErrFormat
+	}
+	rest = strings.TrimSuffix(rest, buggyRequestSuffix)
+	r := &RequestRecord{}
+	r.Method = header[1]
+	r.Duration, _ = strconv.ParseInt(header[2], 10, 64)
+	r.Request = header[3]
+	i := strings.Index(rest, ` $"`)
+	j := strings.LastIndex(rest, ` $"`)
+	if i < 0 || j <= i {
+		return nil, ErrFormat
+	}
+	r.Payload = []byte(rest[:i])
+	c := &cursor{s: rest[i+1 : j]}
+	r.StatusDescription = string(c.quoted())
+	r.Response = []byte(c.s)
+	c.s = rest[j+1:]
+	r.Service = string(c.quoted())
+	if c.err != nil || c.s != "" {
+		return nil, ErrFormat
+	}
+	return r, nil
+}
+
+// Kind 判断日志记录的类型
+func (r *Record) Kind() Kind {
+	switch {
+	case r.Format == FormatTrack:
+		return KindTrack
+	case r.Fields[schemaVersionKey] != nil && r.Message == accessLogMessage:
+		return KindAccess
+	case r.Fields[schemaVersionKey] != nil && r.Message == requestLogMessage:
+		return KindRequest
+	case r.Fields["log_type"] != nil:
+		return KindUnion
+	case r.Format != FormatRaw && r.Level == "INFO":
+		if _, err := ParseAccessLog(r.Message); err == nil {
+			return KindAccess
+		}
+		if _, err := ParseRequestLog(r.Message); err == nil {
+			return KindRequest
+		}
+	}
+	if len(r.Fields) > 0 {
+		return KindUnion
+	}
+	return KindLog
+}
+
+// AccessLog 解析访问日志, 支持旧格式和结构化字段
+func (r *Record) AccessLog() (*AccessRecord, error) {
+	if r.Fields[schemaVersionKey] == nil {
+		return ParseAccessLog(r.Message)
+	}
+	if r.Message != accessLogMessage {
+		return nil, ErrFormat
+	}
+	f := fieldReader(r.Fields)
+	return &AccessRecord{
+		AccessLog: hutils.AccessLog{
+			ClientIP:   f.string("client_ip"),
+			Method:     f.string("method"),
+			Request:    f.string("request"),
+			Protocol:   f.string("protocol"),
+			Agent:      f.string("agent"),
+			LogType:    f.string("log_type"),
+			GrpcStatus: f.string("grpc_status"),
+			Payload:    f.bytes("payload"),
+			Response:   f.bytes("response"),
+			Duration:   f.int64("duration"),
+			StatusCode: int(f.int64("status_code")),
+		},
+		Service: f.string("service"),
+		TraceID: f.string("trace_id"),
+		SpanID:  f.string("span_id"),
+	}, nil
+}
+
+// RequestLog 解析请求日志, 支持旧格式和结构化字段
+func (r *Record) RequestLog() (*RequestRecord, error) {
+	if r.Fields[schemaVersionKey] == nil {
+		return ParseRequestLog(r.Message)
+	}
+	if r.Message != requestLogMessage {
+		return nil, ErrFormat
+	}
+	f := fieldReader(r.Fields)
+	return &RequestRecord{
+		RequestLog: hutils.RequestLog{
+			Method:            f.string("method"),
+			Request:           f.string("request"),
+			StatusDescription: f.string("status_description"),
+			Payload:           f.bytes("payload"),
+			Response:          f.bytes("response"),
+			Duration:          f.int64("duration"),
+		},
+		Service: f.string("service"),
+		TraceID: f.string("trace_id"),
+		SpanID:  f.string("span_id"),
+	}, nil
+}
+
+// unionLogKeys UnionLog.Log记录的字段, 其余字段放入ExtraFields
+var unionLogKeys = map[string]bool{
+	"client_ip": true, "protocol": true, "agent": true, "method": true, "request": true,
+	"payload": true, "response": true, "duration": true, "status_code": true, "log_type": true,
+	"grpc_status": true, "target": true, "msg_received": true, "msg_sent": true,
+}
+
+// UnionLog 由日志字段还原UnionLog, 未知字段放入ExtraFields
+func (r *Record) UnionLog() hutils.UnionLog {
+	f := fieldReader(r.Fields)
+	l := hutils.UnionLog{
+		ClientIP:    f.string("client_ip"),
+		Protocol:    f.string("protocol"),
+		Agent:       f.string("agent"),
+		Method:      f.string("method"),
+		Request:     f.string("request"),
+		GrpcStatus:  f.string("grpc_status"),
+		LogType:     f.string("log_type"),
+		Payload:     f.bytes("payload"),
+		Response:    f.bytes("response"),
+		Duration:    f.int64("duration"),
+		StatusCode:  int(f.int64("status_code")),
+		Target:      f.string("target"),
+		MsgReceived: int(f.int64("msg_received")),
+		MsgSent:     int(f.int64("msg_sent")),
+	}
+	for k := range r.Fields {
+		if unionLogKeys[k] {
+			continue
+		}
+		if l.ExtraFields == nil {
+			l.ExtraFields = map[string]hutils.GetExtraField{}
+		}
+		v := f.string(k)
+		l.ExtraFields[k] = func(context.Context) string { return v }
+	}
+	return l
+}
+
+type fieldReader map[string]interface{}
+
+func (f fieldReader) string(key string) string {
+	switch v := f[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (f fieldReader) bytes(key string) []byte {
+	if v := f.string(key); v != "" {
+		return []byte(v)
+	}
+	return nil
+}
+
+func (f fieldReader) int64(key string) int64 {
+	switch v := f[key].(type) {
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// JSON 转换为hutils JSON格式日志的字段, 旧格式的AccessLog, RequestLog转换为LogSchemaVersion版本的结构化字段
+func (r *Record) JSON() map[string]interface{} {
+	out := make(map[string]interface{}, len(r.Fields)+8)
+	for k, v := range r.Fields {
+		out[k] = v
+	}
+	message := r.Message
+	if r.Fields[schemaVersionKey] == nil {
+		if a, err := ParseAccessLog(message); err == nil && r.Level == "INFO" {
+			message = accessLogMessage
+			a.addFields(out)
+		} else if q, err := ParseRequestLog(message); err == nil && r.Level == "INFO" {
+			message = requestLogMessage
+			q.addFields(out)
+		}
+	}
+	if !r.Time.IsZero() {
+		out["time"] = r.Time.Format(TimeLayout)
+	}
+	for k, v := range map[string]string{
+		"level": r.Level, "name": r.Logger, "path": r.Caller, "func": r.Func, "stacktrace": r.Stacktrace,
+	} {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	out["msg"] = message
+	return out
+}
+
+func (r *AccessRecord) addFields(out map[string]interface{}) {
+	out[schemaVersionKey] = hutils.LogSchemaVersion
+	out["client_ip"] = r.ClientIP
+	out["method"] = r.Method
+	out["request"] = r.Request
+	out["payload"] = string(r.Payload)
+	out["protocol"] = r.Protocol
+	out["status_code"] = r.StatusCode
+	out["duration"] = r.Duration
+	out["agent"] = r.Agent
+	out["service"] = r.Service
+	out["response"] = string(r.Response)
+	out["log_type"] = r.LogType
+	out["grpc_status"] = r.GrpcStatus
+	addTraceFields(out, r.TraceID, r.SpanID)
+}
+
+func (r *RequestRecord) addFields(out map[string]interface{}) {
+	out[schemaVersionKey] = hutils.LogSchemaVersion
+	out["method"] = r.Method
+	out["duration"] = r.Duration
+	out["request"] = r.Request
+	out["payload"] = string(r.Payload)
+	out["status_description"] = r.StatusDescription
+	out["response"] = string(r.Response)
+	out["service"] = r.Service
+	addTraceFields(out, r.TraceID, r.SpanID)
+}
+
+// addTraceFields 与结构化日志一致, 没有trace时不记录
+func addTraceFields(out map[string]interface{}, traceID, spanID string) {
+	if traceID != "" {
+		out["trace_id"] = traceID
+		out["span_id"] = spanID
+	}
+}
@@ -0,0 +1,213 @@
+// Package parser 解析hutils Logger输出的console, json格式日志, 以及AccessLog, RequestLog的旧printf格式.
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TimeLayout hutils日志的时间格式
+const TimeLayout = "2006-01-02 15:04:05"
+
+var (
+	// DefaultEncoderConfig: time level [name] path func msg {fields}, 未设置服务名时没有name
+	defaultHeader = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}) (DEBUG|INFO|WARN|ERROR|DPANIC|PANIC|FATAL) `)
+	// TrackEncoderConfig: service INFO time func msg
+	trackHeader   = regexp.MustCompile(`^(\S*) (INFO) (\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}) `)
+	callerPattern = regexp.MustCompile(`^\S+:\d+$`)
+)
+
+// Format 日志记录的格式
+type Format string
+
+const (
+	FormatConsole Format = "console"
+	FormatTrack   Format = "track"
+	FormatJSON    Format = "json"
+	// FormatRaw 无法识别的内容, 只有Raw
+	FormatRaw Format = "raw"
+)
+
+// Record 一条日志记录, 错误日志的堆栈会和所在的日志合并为一条记录
+type Record struct {
+	Format     Format                 `json:"format"`
+	Time       time.Time              `json:"time"`
+	Level      string                 `json:"level,omitempty"`
+	Logger     string                 `json:"logger,omitempty"`
+	Caller     string                 `json:"caller,omitempty"`
+	Func       string                 `json:"func,omitempty"`
+	Message    string                 `json:"message"`
+	Fields     map[string]interface{} `json:"fields,omitempty"`
+	Stacktrace string                 `json:"stacktrace,omitempty"`
+	Raw        string                 `json:"-"`
+}
+
+// Reader 从日志文件中依次读取Record
+type Reader struct {
+	scanner *bufio.Scanner
+	pending []string
+	err     error
+}
+
+func NewReader(r io.Reader) *Reader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &Reader{scanner: scanner}
+}
+
+// Next 读取下一条记录, 没有更多记录时返回io.EOF
+func (r *Reader) Next() (*Record, error) {
+	for r.err == nil {
+		if !r.scanner.Scan() {
+			if r.err = r.scanner.Err(); r.err == nil {
+				r.err = io.EOF
+			}
+			break
+		}
+		line := r.scanner.Text()
+		// 新记录开始时返回之前缓存的记录
+		if isRecordStart(line) && len(r.pending) > 0 {
+			raw := strings.Join(r.pending, "\n")
+			r.pending = []string{line}
+			return ParseRecord(raw), nil
+		}
+		r.pending = append(r.pending, line)
+		// 以"$"结尾的堆栈行是错误日志的最后一行
+		if strings.HasPrefix(line, "\t") && strings.HasSuffix(line, "$") {
+			raw := strings.Join(r.pending, "\n")
+			r.pending = nil
+			return ParseRecord(raw), nil
+		}
+	}
+	if len(r.pending) > 0 {
+		raw := strings.Join(r.pending, "\n")
+		r.pending = nil
+		return ParseRecord(raw), nil
+	}
+	return nil, r.err
+}
+
+func isRecordStart(line string) bool {
+	return defaultHeader.MatchString(line) || trackHeader.MatchString(line) ||
+		(strings.HasPrefix(line, "{") && json.Valid([]byte(strings.TrimSuffix(line, "$"))))
+}
+
+// ParseRecord 解析一条完整的记录, 包括错误日志的堆栈
+func ParseRecord(raw string) *Record {
+	// 带堆栈的日志以"$\n"结尾
+	text := strings.TrimSuffix(strings.TrimRight(raw, "\r\n"), "$")
+	rec := &Record{Format: FormatRaw, Message: text, Raw: raw}
+	switch {
+	case strings.HasPrefix(text, "{"):
+		parseJSONRecord(rec, text)
+	case defaultHeader.MatchString(text):
+		m := defaultHeader.FindStringSubmatch(text)
+		rec.Format = FormatConsole
+		rec.Time = parseTime(m[1])
+		rec.Level = m[2]
+		rest := text[len(m[0]):]
+		if tokens, _ := splitTokens(rest, 1); len(tokens) == 1 && !callerPattern.MatchString(tokens[0]) {
+			rec.Logger = tokens[0]
+			rest = rest[len(tokens[0])+1:]
+		}
+		tokens, rest := splitTokens(rest, 2)
+		if len(tokens) == 2 {
+			rec.Caller, rec.Func = tokens[0], tokens[1]
+		}
+		parseBody(rec, rest)
+	case trackHeader.MatchString(text):
+		m := trackHeader.FindStringSubmatch(text)
+		rec.Format = FormatTrack
+		rec.Logger = m[1]
+		rec.Level = m[2]
+		rec.Time = parseTime(m[3])
+		tokens, rest := splitTokens(text[len(m[0]):], 1)
+		if len(tokens) == 1 {
+			rec.Func = tokens[0]
+		}
+		parseBody(rec, rest)
+	}
+	return rec
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.ParseInLocation(TimeLayout, s, time.Local)
+	return t
+}
+
+// splitTokens 按单个空格切分出前n个字段, 返回剩余的内容
+func splitTokens(s string, n int) ([]string, string) {
+	tokens := make([]string, 0, n)
+	for len(tokens) < n {
+		i := strings.IndexByte(s, ' ')
+		if i < 0 {
+			if strings.ContainsRune(s, '\n') {
+				break
+			}
+			return append(tokens, s), ""
+		}
+		if nl := strings.IndexByte(s, '\n'); nl >= 0 && nl < i {
+			break
+		}
+		tokens = append(tokens, s[:i])
+		s = s[i+1:]
+	}
+	return tokens, s
+}
+
+// parseBody 解析msg, 结尾的json字段以及堆栈
+func parseBody(rec *Record, body string) {
+	lines := strings.Split(body, "\n")
+	lines, stack := splitStack(lines)
+	rec.Stacktrace = strings.Join(stack, "\n")
+	last := lines[len(lines)-1]
+	// 字段为" {...}", 从左往右找到第一个合法的json对象
+	for i := 0; i < len(last); i++ {
+		if last[i] != '{' || (i > 0 && last[i-1] != ' ') {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(last[i:]), &fields); err == nil {
+			rec.Fields = fields
+			lines[len(lines)-1] = strings.TrimSuffix(last[:i], " ")
+			break
+		}
+	}
+	rec.Message = strings.Join(lines, "\n")
+}
+
+// splitStack zap的堆栈为"函数\n\t文件:行号"成对出现, 从结尾找出堆栈部分
+func splitStack(lines []string) ([]string, []string) {
+	start := len(lines)
+	for start-2 >= 1 && strings.HasPrefix(lines[start-1], "\t") && !strings.HasPrefix(lines[start-2], "\t") {
+		start -= 2
+	}
+	return lines[:start], lines[start:]
+}
+
+func parseJSONRecord(rec *Record, text string) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return
+	}
+	rec.Format = FormatJSON
+	take := func(key string) string {
+		v, _ := fields[key].(string)
+		delete(fields, key)
+		return v
+	}
+	rec.Time = parseTime(take("time"))
+	rec.Level = take("level")
+	rec.Logger = take("name")
+	rec.Caller = take("path")
+	rec.Func = take("func")
+	rec.Message = take("msg")
+	rec.Stacktrace = take("stacktrace")
+	if len(fields) > 0 {
+		rec.Fields = fields
+	}
+}
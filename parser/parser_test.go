@@ -0,0 +1,142 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	hutils "github.com/zaihui/go-hutils"
+)
+
+func readAll(t *testing.T, text string) []*Record {
+	reader := NewReader(strings.NewReader(text))
+	var records []*Record
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return records
+		}
+		assert.Nil(t, err)
+		records = append(records, rec)
+	}
+}
+
+func capture(t *testing.T, f func()) string {
+	output, err := hutils.CaptureStdout(f)
+	assert.Nil(t, err)
+	return strings.Join(output, "\n")
+}
+
+func TestParseLegacyLogs(t *testing.T) {
+	hutils.SetLegacyLogFormat(true)
+	defer hutils.SetLegacyLogFormat(false)
+	access := hutils.AccessLog{
+		ClientIP: "127.0.0.1", Method: "GET", Request: "/ping?a=1", Protocol: "HTTP/1.1",
+		Agent: `curl "7.0"`, GrpcStatus: "OK", Payload: []byte("a b\n\"c\""), Response: []byte(`{"ok": true}`),
+		Duration: 12, StatusCode: 200,
+	}
+	request := hutils.RequestLog{
+		Method: "POST", Request: "/order", StatusDescription: "200 OK",
+		Payload: []byte(`{"id": 1}`), Response: []byte("done"), Duration: 34,
+	}
+	text := capture(t, func() {
+		sugarLog := (&hutils.Logger{}).Init(hutils.LoggerOpt{EnableStdout: true}).Sugar()
+		access.Log(sugarLog)
+		request.Log(sugarLog)
+		request.LogWithContext(context.Background(), sugarLog)
+		sugarLog.Infow("plain", "k", "v")
+	})
+	records := readAll(t, text)
+	assert.Equal(t, 4, len(records))
+
+	assert.Equal(t, KindAccess, records[0].Kind())
+	a, err := records[0].AccessLog()
+	assert.Nil(t, err)
+	access.LogType = "http"
+	assert.Equal(t, access, a.AccessLog)
+	assert.Equal(t, "INFO", records[0].Level)
+	assert.False(t, records[0].Time.IsZero())
+
+	for _, rec := range records[1:3] {
+		assert.Equal(t, KindRequest, rec.Kind())
+		r, err := rec.RequestLog()
+		assert.Nil(t, err)
+		assert.Equal(t, request, r.RequestLog)
+	}
+
+	assert.Equal(t, KindUnion, records[3].Kind())
+	assert.Equal(t, "plain", records[3].Message)
+	assert.Equal(t, "v", records[3].Fields["k"])
+
+	out := records[0].JSON()
+	assert.Equal(t, "access", out["msg"])
+	assert.Equal(t, hutils.LogSchemaVersion, out[schemaVersionKey])
+	assert.Equal(t, "a b\n\"c\"", out["payload"])
+}
+
+func TestParseStructuredAccessLog(t *testing.T) {
+	access := hutils.AccessLog{Method: "GET", Request: "/ping", Payload: []byte("p"), Duration: 5, StatusCode: 200, LogType: "grpc"}
+	text := capture(t, func() {
+		access.Log((&hutils.Logger{}).Init(hutils.LoggerOpt{EnableStdout: true}).Sugar())
+	})
+	records := readAll(t, text)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, KindAccess, records[0].Kind())
+	a, err := records[0].AccessLog()
+	assert.Nil(t, err)
+	assert.Equal(t, access, a.AccessLog)
+}
+
+func TestParseBuggyRequestLog(t *testing.T) {
+	r, err := ParseRequestLog(`GET %!s(int64=12) %!d(string=/ping) {"a": 1} $"200 OK"$ pong $"svc"$ %!s(MISSING)`)
+	assert.Nil(t, err)
+	assert.Equal(t, hutils.RequestLog{
+		Method: "GET", Duration: 12, Request: "/ping", Payload: []byte(`{"a": 1}`),
+		StatusDescription: "200 OK", Response: []byte("pong"),
+	}, r.RequestLog)
+	assert.Equal(t, "svc", r.Service)
+
+	_, err = ParseRequestLog("not a request log")
+	assert.Equal(t, ErrFormat, err)
+}
+
+func TestParseErrorStack(t *testing.T) {
+	text := capture(t, func() {
+		sugarLog := (&hutils.Logger{Type: hutils.ERROR}).Init(hutils.LoggerOpt{EnableStdout: true}).Sugar()
+		sugarLog.Error("first\nsecond")
+		hutils.UnionLog{ExtraFields: map[string]hutils.GetExtraField{
+			"user": func(context.Context) string { return "u1" },
+		}}.Error(context.Background(), sugarLog, errors.New("failed"))
+	})
+	records := readAll(t, text)
+	assert.Equal(t, 2, len(records))
+
+	assert.Equal(t, "ERROR", records[0].Level)
+	assert.Equal(t, "first\nsecond", records[0].Message)
+	assert.Contains(t, records[0].Stacktrace, "TestParseErrorStack")
+	assert.True(t, strings.HasPrefix(records[0].Caller, "parser/parser_test.go:"))
+
+	assert.Equal(t, KindUnion, records[1].Kind())
+	assert.Equal(t, "failed", records[1].Message)
+	assert.NotEmpty(t, records[1].Stacktrace)
+	l := records[1].UnionLog()
+	assert.Equal(t, "u1", l.ExtraFields["user"](context.Background()))
+}
+
+func TestParseTrackLog(t *testing.T) {
+	hutils.SetServiceName("svc")
+	defer hutils.SetServiceName("default")
+	text := capture(t, func() {
+		sugarLog := (&hutils.Logger{Type: hutils.TRACK}).Init(hutils.LoggerOpt{EnableStdout: true}).Sugar()
+		hutils.Track(sugarLog, "tracked message")
+	})
+	records := readAll(t, text)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, KindTrack, records[0].Kind())
+	assert.Equal(t, "svc", records[0].Logger)
+	assert.Equal(t, "tracked message", records[0].Message)
+	assert.NotEmpty(t, records[0].Func)
+}
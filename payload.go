@@ -0,0 +1,115 @@
+package hutils
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+)
+
+// TruncatedMarker 截断后追加的标记
+const TruncatedMarker = "...(truncated, %d bytes)"
+
+// PayloadLimiter 控制日志中请求参数、响应结果的记录, 被跳过或未被采样时仍会记录其他访问信息.
+// 创建一次后通过WithPayloadLimiter/WithHTTPPayloadLimiter传给拦截器和中间件, nil表示完整记录.
+type PayloadLimiter struct {
+	maxBytes     int
+	sampleRate   float64
+	methods      []string
+	contentTypes []string
+}
+
+type PayloadLimiterOption func(*PayloadLimiter)
+
+// LimitPayloadSize 超过n字节的内容会被截断, 并追加TruncatedMarker
+func LimitPayloadSize(n int) PayloadLimiterOption {
+	return func(p *PayloadLimiter) {
+		p.maxBytes = n
+	}
+}
+
+// SkipPayloadMethods 不记录这些方法的内容, grpc为FullMethod, http为请求方法或path
+func SkipPayloadMethods(methods ...string) PayloadLimiterOption {
+	return func(p *PayloadLimiter) {
+		p.methods = append(p.methods, methods...)
+	}
+}
+
+// SkipPayloadContentTypes 不记录这些content-type的内容, 按前缀匹配, 如: multipart/form-data, image/
+func SkipPayloadContentTypes(contentTypes ...string) PayloadLimiterOption {
+	return func(p *PayloadLimiter) {
+		p.contentTypes = append(p.contentTypes, contentTypes...)
+	}
+}
+
+// SamplePayload 按rate(0~1)的比例采样记录内容
+func SamplePayload(rate float64) PayloadLimiterOption {
+	return func(p *PayloadLimiter) {
+		p.sampleRate = rate
+	}
+}
+
+func NewPayloadLimiter(opts ...PayloadLimiterOption) *PayloadLimiter {
+	p := &PayloadLimiter{sampleRate: 1}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Sampled 本次请求是否记录内容, 每个请求调用一次
+func (p *PayloadLimiter) Sampled() bool {
+	if p == nil || p.sampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < p.sampleRate
+}
+
+// SkipMethod 是否跳过该方法的内容
+func (p *PayloadLimiter) SkipMethod(methods ...string) bool {
+	if p == nil {
+		return false
+	}
+	for _, method := range methods {
+		if FilterMethod(p.methods, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// SkipContentType 是否跳过该content-type的内容
+func (p *PayloadLimiter) SkipContentType(contentType string) bool {
+	if p == nil || contentType == "" {
+		return false
+	}
+	contentType = strings.ToLower(contentType)
+	for _, t := range p.contentTypes {
+		if strings.HasPrefix(contentType, strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Truncate 截断超出长度的内容, 不会截断在utf8字符中间
+func (p *PayloadLimiter) Truncate(b []byte) []byte {
+	return p.truncate(b, len(b))
+}
+
+// truncate 同Truncate, size为内容的原始长度, 大于len(b)时说明b只是部分内容
+func (p *PayloadLimiter) truncate(b []byte, size int) []byte {
+	n := len(b)
+	if p != nil && p.maxBytes > 0 && p.maxBytes < n {
+		n = p.maxBytes
+	}
+	if n == len(b) && size <= len(b) {
+		return b
+	}
+	for n > 0 && n < len(b) && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	out := make([]byte, n, n+len(TruncatedMarker)+8)
+	copy(out, b[:n])
+	return append(out, fmt.Sprintf(TruncatedMarker, size)...)
+}
@@ -0,0 +1,47 @@
+package hutils
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPayloadLimiterTruncate(t *testing.T) {
+	limiter := NewPayloadLimiter(LimitPayloadSize(4))
+	assert.Equal(t, "1234", string(limiter.Truncate([]byte("1234"))))
+	assert.Equal(t, "1234"+fmt.Sprintf(TruncatedMarker, 6), string(limiter.Truncate([]byte("123456"))))
+	// 不会截断在utf8字符中间
+	assert.Equal(t, "12"+fmt.Sprintf(TruncatedMarker, 5), string(limiter.Truncate([]byte("12中"))))
+
+	var nilLimiter *PayloadLimiter
+	assert.Equal(t, "123456", string(nilLimiter.Truncate([]byte("123456"))))
+	// 只缓存了部分内容时也需要标记截断
+	assert.Equal(t, "12"+fmt.Sprintf(TruncatedMarker, 10), string(nilLimiter.truncate([]byte("12"), 10)))
+}
+
+func TestPayloadLimiterSkip(t *testing.T) {
+	limiter := NewPayloadLimiter(
+		SkipPayloadMethods("/upload.Service/Upload", "PUT"),
+		SkipPayloadContentTypes("multipart/form-data", "image/"),
+	)
+	assert.True(t, limiter.SkipMethod("/upload.Service/Upload"))
+	assert.True(t, limiter.SkipMethod("PUT", "/users"))
+	assert.False(t, limiter.SkipMethod("POST", "/users"))
+	assert.True(t, limiter.SkipContentType("multipart/form-data; boundary=xxx"))
+	assert.True(t, limiter.SkipContentType("IMAGE/png"))
+	assert.False(t, limiter.SkipContentType("application/json"))
+	assert.False(t, limiter.SkipContentType(""))
+
+	var nilLimiter *PayloadLimiter
+	assert.False(t, nilLimiter.SkipMethod("PUT"))
+	assert.False(t, nilLimiter.SkipContentType("image/png"))
+}
+
+func TestPayloadLimiterSampled(t *testing.T) {
+	assert.True(t, NewPayloadLimiter().Sampled())
+	assert.False(t, NewPayloadLimiter(SamplePayload(0)).Sampled())
+
+	var nilLimiter *PayloadLimiter
+	assert.True(t, nilLimiter.Sampled())
+}
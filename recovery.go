@@ -0,0 +1,115 @@
+package hutils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/SkyAPM/go2sky"
+	"github.com/pkg/errors"
+	"go.elastic.co/apm"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// PanicTag span中记录panic的key
+const PanicTag = "panic"
+
+// NewUnaryServerRecoveryInterceptor 捕获handler中的panic, 记录日志及堆栈, 标记span为错误并返回codes.Internal.
+// panic的值为CodeError时同样记录日志及堆栈, 按业务码返回. 放在trace拦截器之后才能标记对应的span.
+func NewUnaryServerRecoveryInterceptor(logger *zap.SugaredLogger, opts ...Option) grpc.UnaryServerInterceptor {
+	options := newOptions(opts...)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = options.recoverError(ctx, logger, info.FullMethod, p)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// NewStreamServerRecoveryInterceptor 同NewUnaryServerRecoveryInterceptor, 用于stream.
+func NewStreamServerRecoveryInterceptor(logger *zap.SugaredLogger, opts ...Option) grpc.StreamServerInterceptor {
+	options := newOptions(opts...)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = options.recoverError(stream.Context(), logger, info.FullMethod, p)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+// recoverError 记录panic并转换为grpc状态, panic一定是bug, 无论是否为CodeError都记录堆栈
+func (o *options) recoverError(ctx context.Context, logger *zap.SugaredLogger, method string, p interface{}) error {
+	err := panicError(p)
+	markSpanError(ctx, err)
+	l := UnionLog{Request: method, LogType: grpcLogType}
+	l.Errorf(ctx, logger, "panic: %v\n%s", p, debug.Stack())
+	var codeErr CodeError
+	if !errors.As(err, &codeErr) {
+		z := NewZError(ctx, InternalErrorCode, InternalErrorMessage)
+		if !o.production {
+			z.Message = fmt.Sprintf("panic: %v", p)
+		}
+		return z.grpcStatus(codes.Internal, false).Err()
+	}
+	return o.translateError(ctx, logger, method, err)
+}
+
+// recoverPanic 捕获http handler中的panic, 需要直接使用defer调用
+func (h handler) recoverPanic(w *responseWriter, r *http.Request) {
+	if e := recover(); e != nil {
+		// http.ErrAbortHandler用于中断响应, 保持net/http的处理方式
+		if e == http.ErrAbortHandler {
+			panic(e)
+		}
+		recoverHTTP(w, r, h.logger, e)
+	}
+}
+
+// recoverHTTP 记录panic及堆栈, 响应还未写入时以ErrorResponse格式返回. logger为nil时使用标准库log
+func recoverHTTP(w *responseWriter, r *http.Request, logger *zap.SugaredLogger, p interface{}) {
+	err := panicError(p)
+	markSpanError(r.Context(), err)
+	if logger != nil {
+		l := UnionLog{Method: r.Method, Request: r.URL.RequestURI()}
+		l.Errorf(r.Context(), logger, "panic: %v\n%s", p, debug.Stack())
+	} else {
+		log.Printf("panic: %v\n%s", p, debug.Stack())
+	}
+	// 已经开始写响应时无法再修改状态码
+	if !w.wroteHeader {
+		WriteError(w, r, err)
+	}
+}
+
+func panicError(p interface{}) error {
+	if err, ok := p.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", p)
+}
+
+// markSpanError 将ctx中的SkyWalking span, OpenTelemetry span以及APM事务标记为错误
+func markSpanError(ctx context.Context, err error) {
+	if span := go2sky.ActiveSpan(ctx); span != nil {
+		span.Error(time.Now(), PanicTag, err.Error())
+	}
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+	}
+	if tx := apm.TransactionFromContext(ctx); tx != nil {
+		tx.Outcome = "failure"
+		apm.CaptureError(ctx, err).Send()
+	}
+}
@@ -0,0 +1,107 @@
+package hutils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SkyAPM/go2sky"
+	"github.com/stretchr/testify/assert"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerRecoveryInterceptor(t *testing.T) {
+	RegisterGRPCCode("40005", codes.InvalidArgument)
+	recorder := newSpanRecorder()
+	defer InitTracerProvider().UnregisterSpanProcessor(recorder)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Ping"}
+	var errs []error
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		for _, production := range []bool{false, true} {
+			interceptor := NewUnaryServerRecoveryInterceptor(sugarLog, WithProductionMode(production))
+			ctx, span := otelTracer().Start(context.Background(), info.FullMethod)
+			_, err := interceptor(ctx, goodPing, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				var m map[string]int
+				m["nil"]++
+				return nil, nil
+			})
+			span.End()
+			errs = append(errs, err)
+		}
+		// panic的值为CodeError时按业务码返回
+		interceptor := NewUnaryServerRecoveryInterceptor(sugarLog)
+		_, err := interceptor(context.Background(), goodPing, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			panic(NewZError(ctx, "40005", "参数错误"))
+		})
+		errs = append(errs, err)
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, codes.Internal, status.Code(errs[0]))
+	assert.Contains(t, status.Convert(errs[0]).Message(), "assignment to entry in nil map")
+	assert.Equal(t, InternalErrorMessage, status.Convert(errs[1]).Message())
+	assert.Equal(t, codes.InvalidArgument, status.Code(errs[2]))
+	assert.Equal(t, "参数错误", status.Convert(errs[2]).Message())
+
+	logs := strings.Join(output, "\n")
+	assert.Contains(t, logs, "panic: assignment to entry in nil map")
+	assert.Contains(t, logs, "TestUnaryServerRecoveryInterceptor")
+	// panic的值为CodeError时同样记录日志及堆栈
+	assert.Contains(t, logs, "panic: 40005: 参数错误")
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, otelcodes.Error, spans[0].Status().Code)
+}
+
+func TestStreamServerRecoveryInterceptor(t *testing.T) {
+	_, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		interceptor := NewStreamServerRecoveryInterceptor(sugarLog)
+		info := &grpc.StreamServerInfo{FullMethod: "/test.Service/PingList"}
+		err := interceptor(nil, &fakeServerStream{}, info, func(srv interface{}, stream grpc.ServerStream) error {
+			panic("boom")
+		})
+		assert.Equal(t, codes.Internal, status.Code(err))
+	})
+	assert.NoError(t, err)
+}
+
+func TestSkywalkingHTTPMiddlewareRecovery(t *testing.T) {
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 1)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		middleware, err := NewServerSkywalkingHTTPMiddleware(tracer, WithHTTPLogger(sugarLog),
+			WithOperation(func(name string, r *http.Request) string { return r.URL.Path }))
+		assert.NoError(t, err)
+		h := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, httptest.NewRequest("GET", "/ping", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rw.Code)
+		var resp ErrorResponse
+		assert.NoError(t, json.Unmarshal(rw.Body.Bytes(), &resp))
+		assert.Equal(t, InternalErrorCode, resp.Code)
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, strings.Join(output, "\n"), "panic: boom")
+
+	span := <-recorder.spans
+	assert.True(t, span.IsError())
+}
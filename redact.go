@@ -0,0 +1,399 @@
+package hutils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	// nolint:staticcheck
+	// ignore SA1019 Need to keep deprecated package for compatibility.
+	protoV1 "github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// MaskFunc 脱敏策略, 输入原始值返回脱敏后的值
+type MaskFunc func(value string) string
+
+// UnparseablePayload 内容是无法解析的json(如超出MaxCaptureBodySize被截断)时, 以此代替原内容记录
+const UnparseablePayload = "<redacted: unparseable>"
+
+// MaskAll 全部替换为*
+func MaskAll(value string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(value))
+}
+
+// MaskKeepLast4 只保留最后4位, 其余替换为*
+func MaskKeepLast4(value string) string {
+	runes := []rune(value)
+	if len(runes) <= 4 {
+		return MaskAll(value)
+	}
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
+
+// MaskHash 替换为sha256摘要, 相同的值脱敏后仍可关联
+func MaskHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type pathRule struct {
+	path []string
+	mask MaskFunc
+}
+
+type fieldRule struct {
+	names []string
+	mask  MaskFunc
+}
+
+type optionRule struct {
+	ext  protoreflect.ExtensionType
+	mask MaskFunc
+}
+
+type regexpRule struct {
+	re   *regexp.Regexp
+	mask MaskFunc
+}
+
+// Redactor 对日志和span中的请求参数、响应结果脱敏.
+// 创建一次后通过WithRedactor/WithHTTPRedactor传给拦截器和中间件, nil表示不脱敏.
+type Redactor struct {
+	paths   []pathRule
+	fields  []fieldRule
+	options []optionRule
+	regexps []regexpRule
+}
+
+type RedactorOption func(*Redactor)
+
+// RedactJSONPath 按json路径脱敏, 路径以.分隔, *匹配任意key或数组下标, 数组会被自动展开. 如: user.phone, items.*.id_card
+func RedactJSONPath(path string, mask MaskFunc) RedactorOption {
+	return func(r *Redactor) {
+		r.paths = append(r.paths, pathRule{path: strings.Split(path, "."), mask: mask})
+	}
+}
+
+// RedactField 按字段名脱敏, 匹配任意层级的字段, proto字段名会同时匹配其json名(lowerCamelCase)
+func RedactField(name string, mask MaskFunc) RedactorOption {
+	return func(r *Redactor) {
+		names := []string{name}
+		if camel := lowerCamelCase(name); camel != name {
+			names = append(names, camel)
+		}
+		r.fields = append(r.fields, fieldRule{names: names, mask: mask})
+	}
+}
+
+// RedactFieldOption 按proto字段选项脱敏, ext为扩展FieldOptions的bool选项, 如: string phone = 1 [(sensitive) = true];
+// 只对string类型的字段生效.
+func RedactFieldOption(ext protoreflect.ExtensionType, mask MaskFunc) RedactorOption {
+	return func(r *Redactor) {
+		r.options = append(r.options, optionRule{ext: ext, mask: mask})
+	}
+}
+
+// RedactRegexp 按正则脱敏, 作用于序列化后的整段文本
+func RedactRegexp(re *regexp.Regexp, mask MaskFunc) RedactorOption {
+	return func(r *Redactor) {
+		r.regexps = append(r.regexps, regexpRule{re: re, mask: mask})
+	}
+}
+
+func NewRedactor(opts ...RedactorOption) *Redactor {
+	r := &Redactor{}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Marshal 同MarshalJSON, 返回脱敏后的结果
+func (r *Redactor) Marshal(msg interface{}) ([]byte, error) {
+	b, err := MarshalJSON(r.redactMessage(msg))
+	if err != nil {
+		return nil, err
+	}
+	return r.Redact(b), nil
+}
+
+// MarshalParam 同MarshalParam, 返回脱敏后的结果
+func (r *Redactor) MarshalParam(v interface{}) string {
+	return string(r.Redact([]byte(MarshalParam(r.redactMessage(v)))))
+}
+
+// Redact 对序列化后的内容脱敏, 非json内容只应用正则规则
+func (r *Redactor) Redact(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+	if len(r.paths) > 0 || len(r.fields) > 0 {
+		b, _ = r.redactJSON(b)
+	}
+	return r.redactRegexps(b)
+}
+
+// redactPayload 同Redact, 用于http中间件记录的请求和响应内容.
+// 内容看起来是json但无法解析时, 字段规则无法生效, 返回UnparseablePayload避免敏感字段原样输出.
+func (r *Redactor) redactPayload(b []byte) []byte {
+	if r == nil || len(b) == 0 {
+		return b
+	}
+	if len(r.paths) > 0 || len(r.fields) > 0 {
+		var ok bool
+		if b, ok = r.redactJSON(b); !ok && looksLikeJSON(b) {
+			return []byte(UnparseablePayload)
+		}
+	}
+	return r.redactRegexps(b)
+}
+
+func looksLikeJSON(b []byte) bool {
+	b = bytes.TrimSpace(b)
+	return len(b) > 0 && (b[0] == '{' || b[0] == '[')
+}
+
+// RedactQuery 对url query脱敏, 字段名规则和单层的json路径规则按参数名匹配, 正则规则作用于整个query
+func (r *Redactor) RedactQuery(rawQuery string) string {
+	if r == nil || rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			continue
+		}
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			continue
+		}
+		mask := r.queryMask(name)
+		if mask == nil {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(value); err == nil {
+			value = unescaped
+		}
+		// query中可以直接使用*, 保持脱敏结果可读
+		params[i] = key + "=" + strings.ReplaceAll(url.QueryEscape(mask(value)), "%2A", "*")
+	}
+	return string(r.redactRegexps([]byte(strings.Join(params, "&"))))
+}
+
+func (r *Redactor) queryMask(name string) MaskFunc {
+	if mask := r.fieldMask(name); mask != nil {
+		return mask
+	}
+	for _, rule := range r.paths {
+		if len(rule.path) == 1 && (rule.path[0] == "*" || rule.path[0] == name) {
+			return rule.mask
+		}
+	}
+	return nil
+}
+
+func (r *Redactor) redactRegexps(b []byte) []byte {
+	for _, rule := range r.regexps {
+		b = rule.re.ReplaceAllFunc(b, func(match []byte) []byte {
+			return []byte(rule.mask(string(match)))
+		})
+	}
+	return b
+}
+
+// redactJSON 按json路径和字段名脱敏, 无法解析时原样返回b和false
+func (r *Redactor) redactJSON(b []byte) ([]byte, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return b, false
+	}
+	for _, rule := range r.paths {
+		v = redactPath(v, rule.path, rule.mask)
+	}
+	if len(r.fields) > 0 {
+		v = r.redactFields(v)
+	}
+	out, err := JSONMarshal(v)
+	if err != nil {
+		return b, false
+	}
+	// JSONMarshal会追加换行, 保持与原内容一致
+	if !bytes.HasSuffix(b, []byte("\n")) {
+		out = bytes.TrimSuffix(out, []byte("\n"))
+	}
+	return out, true
+}
+
+func (r *Redactor) redactFields(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if mask := r.fieldMask(k); mask != nil {
+				value[k] = maskValue(child, mask)
+			} else {
+				value[k] = r.redactFields(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = r.redactFields(child)
+		}
+	}
+	return v
+}
+
+func (r *Redactor) fieldMask(key string) MaskFunc {
+	for _, rule := range r.fields {
+		for _, name := range rule.names {
+			if name == key {
+				return rule.mask
+			}
+		}
+	}
+	return nil
+}
+
+func redactPath(v interface{}, path []string, mask MaskFunc) interface{} {
+	if len(path) == 0 {
+		return maskValue(v, mask)
+	}
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if path[0] == "*" || path[0] == k {
+				value[k] = redactPath(child, path[1:], mask)
+			}
+		}
+	case []interface{}:
+		// *匹配数组下标, 否则数组对路径透明
+		rest := path
+		if path[0] == "*" {
+			rest = path[1:]
+		}
+		for i, child := range value {
+			value[i] = redactPath(child, rest, mask)
+		}
+	}
+	return v
+}
+
+// maskValue 脱敏json值, 对象和数组中的每个值都会被脱敏
+func maskValue(v interface{}, mask MaskFunc) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return mask(value)
+	case json.Number:
+		return mask(value.String())
+	case map[string]interface{}:
+		for k, child := range value {
+			value[k] = maskValue(child, mask)
+		}
+		return value
+	case []interface{}:
+		for i, child := range value {
+			value[i] = maskValue(child, mask)
+		}
+		return value
+	default:
+		return v
+	}
+}
+
+// redactMessage 按字段选项脱敏proto消息, 返回脱敏后的副本
+func (r *Redactor) redactMessage(msg interface{}) interface{} {
+	if r == nil || len(r.options) == 0 {
+		return msg
+	}
+	pb, ok := msg.(protoV1.Message)
+	if !ok {
+		return msg
+	}
+	m := proto.Clone(protoV1.MessageV2(pb))
+	r.redactReflect(m.ProtoReflect())
+	return protoV1.MessageV1(m)
+}
+
+func (r *Redactor) redactReflect(m protoreflect.Message) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+	for _, fd := range fields {
+		if mask := r.optionMask(fd); mask != nil && fd.Kind() == protoreflect.StringKind {
+			switch {
+			case fd.IsList():
+				list := m.Mutable(fd).List()
+				for i := 0; i < list.Len(); i++ {
+					list.Set(i, protoreflect.ValueOfString(mask(list.Get(i).String())))
+				}
+			case !fd.IsMap():
+				m.Set(fd, protoreflect.ValueOfString(mask(m.Get(fd).String())))
+			}
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				m.Get(fd).Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					r.redactReflect(v.Message())
+					return true
+				})
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			list := m.Get(fd).List()
+			for i := 0; i < list.Len(); i++ {
+				r.redactReflect(list.Get(i).Message())
+			}
+		default:
+			r.redactReflect(m.Get(fd).Message())
+		}
+	}
+}
+
+func (r *Redactor) optionMask(fd protoreflect.FieldDescriptor) MaskFunc {
+	opts := fd.Options()
+	if opts == nil {
+		return nil
+	}
+	for _, rule := range r.options {
+		if !proto.HasExtension(opts, rule.ext) {
+			continue
+		}
+		if enabled, ok := proto.GetExtension(opts, rule.ext).(bool); ok && enabled {
+			return rule.mask
+		}
+	}
+	return nil
+}
+
+// lowerCamelCase 将proto字段名转换为jsonpb默认使用的json名
+func lowerCamelCase(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range name {
+		if c == '_' {
+			upper = true
+			continue
+		}
+		if upper && 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package hutils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	pb_testproto "github.com/grpc-ecosystem/go-grpc-middleware/testing/testproto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestMaskFunc(t *testing.T) {
+	assert.Equal(t, "*****", MaskAll("12345"))
+	assert.Equal(t, "*******5678", MaskKeepLast4("13812345678"))
+	assert.Equal(t, "***", MaskKeepLast4("123"))
+	assert.Equal(t, MaskHash("token"), MaskHash("token"))
+	assert.True(t, strings.HasPrefix(MaskHash("token"), "sha256:"))
+}
+
+func TestRedactJSON(t *testing.T) {
+	redactor := NewRedactor(
+		RedactJSONPath("user.phone", MaskKeepLast4),
+		RedactJSONPath("items.*.id", MaskAll),
+		RedactField("access_token", MaskHash),
+		RedactRegexp(regexp.MustCompile(`\d{17}[\dX]`), MaskAll),
+	)
+	b := redactor.Redact([]byte(`{"user":{"phone":"13812345678","name":"n"},"items":[{"id":12},{"id":"ab"}],` +
+		`"auth":{"accessToken":"secret"},"remark":"110101199003071234"}`))
+	s := string(b)
+	assert.Contains(t, s, `"phone":"*******5678"`)
+	assert.Contains(t, s, `"name":"n"`)
+	assert.Contains(t, s, `{"id":"**"},{"id":"**"}`)
+	assert.Contains(t, s, `"accessToken":"`+MaskHash("secret")+`"`)
+	assert.Contains(t, s, `"remark":"******************"`)
+
+	// 非json内容只应用正则
+	assert.Equal(t, "id=******************", string(redactor.Redact([]byte("id=110101199003071234"))))
+
+	var nilRedactor *Redactor
+	assert.Equal(t, "raw", string(nilRedactor.Redact([]byte("raw"))))
+}
+
+func TestRedactQuery(t *testing.T) {
+	redactor := NewRedactor(
+		RedactJSONPath("sign", MaskHash),
+		RedactField("token", MaskAll),
+		RedactRegexp(regexp.MustCompile(`\d{11}`), MaskKeepLast4),
+	)
+	assert.Equal(t, "token=***&sign="+url.QueryEscape(MaskHash("a b"))+"&phone=*******5678&flag",
+		redactor.RedactQuery("token=abc&sign=a+b&phone=13812345678&flag"))
+	var nilRedactor *Redactor
+	assert.Equal(t, "token=abc", nilRedactor.RedactQuery("token=abc"))
+}
+
+func TestRedactorMarshal(t *testing.T) {
+	redactor := NewRedactor(RedactField("value", MaskAll))
+	b, err := redactor.Marshal(goodPing)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "goodPing")
+	assert.Contains(t, string(b), "sleepTimeMs")
+	assert.NotContains(t, redactor.MarshalParam(goodPing), "goodPing")
+
+	var nilRedactor *Redactor
+	b, err = nilRedactor.Marshal(goodPing)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "goodPing")
+}
+
+func TestRedactFieldOption(t *testing.T) {
+	ext, msgDesc := sensitiveDescriptors(t)
+	msg := dynamicpb.NewMessage(msgDesc)
+	msg.Set(msgDesc.Fields().ByName("phone"), protoreflect.ValueOfString("13812345678"))
+	msg.Set(msgDesc.Fields().ByName("name"), protoreflect.ValueOfString("zaihui"))
+
+	redactor := NewRedactor(RedactFieldOption(ext, MaskKeepLast4))
+	b, err := redactor.Marshal(msg)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"phone":"*******5678"`)
+	assert.Contains(t, string(b), `"name":"zaihui"`)
+	// 原消息不应被修改
+	assert.Equal(t, "13812345678", msg.Get(msgDesc.Fields().ByName("phone")).String())
+
+	// 没有字段选项的消息保持不变
+	b, err = redactor.Marshal(&pb_testproto.PingRequest{Value: "ping"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "ping")
+}
+
+// sensitiveDescriptors 动态生成 extend FieldOptions { bool sensitive = 50000; } 以及使用该选项的消息
+func sensitiveDescriptors(t *testing.T) (protoreflect.ExtensionType, protoreflect.MessageDescriptor) {
+	files := &protoregistry.Files{}
+	assert.NoError(t, files.RegisterFile(descriptorpb.File_google_protobuf_descriptor_proto))
+	extFile, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("hutils/options.proto"),
+		Package:    proto.String("hutils"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/descriptor.proto"},
+		Extension: []*descriptorpb.FieldDescriptorProto{{
+			Name:     proto.String("sensitive"),
+			Number:   proto.Int32(50000),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum(),
+			Extendee: proto.String(".google.protobuf.FieldOptions"),
+			JsonName: proto.String("sensitive"),
+		}},
+	}, files)
+	assert.NoError(t, err)
+	assert.NoError(t, files.RegisterFile(extFile))
+	ext := dynamicpb.NewExtensionType(extFile.Extensions().Get(0))
+
+	fieldOpts := &descriptorpb.FieldOptions{}
+	proto.SetExtension(fieldOpts, ext, true)
+	msgFile, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("hutils/user.proto"),
+		Package:    proto.String("hutils"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"hutils/options.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("User"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("phone"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("phone"),
+				Options:  fieldOpts,
+			}, {
+				Name:     proto.String("name"),
+				Number:   proto.Int32(2),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("name"),
+			}},
+		}},
+	}, files)
+	assert.NoError(t, err)
+	return ext, msgFile.Messages().Get(0)
+}
@@ -0,0 +1,177 @@
+package hutils
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+// MaxCaptureBodySize 中间件记录响应内容时最多缓存的字节数, 超出部分不会被记录
+var MaxCaptureBodySize = 1 << 20
+
+// responseWriter is a wrapper for http.ResponseWriter that allows the
+// written HTTP status code and a bounded copy of the body to be captured for logging.
+// Use writer() to get the http.ResponseWriter passed to the next handler, it implements
+// http.Flusher, http.Hijacker and http.Pusher only when the wrapped http.ResponseWriter does.
+// nolint: govet
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        []byte
+	// max bytes of body to capture, 0 means not capture.
+	maxBody int
+	// total bytes written.
+	size int
+}
+
+func wrapResponseWriter(w http.ResponseWriter, maxBody int) *responseWriter {
+	return &responseWriter{ResponseWriter: w, maxBody: maxBody}
+}
+
+// Status 返回响应状态码, 未显式写入时为200
+func (rw *responseWriter) Status() int {
+	if !rw.wroteHeader {
+		return http.StatusOK
+	}
+	return rw.status
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	if rw.wroteHeader {
+		return
+	}
+	rw.status = code
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.capture(b[:n])
+	return n, err
+}
+
+func (rw *responseWriter) capture(b []byte) {
+	rw.size += len(b)
+	if remain := rw.maxBody - len(rw.body); remain > 0 {
+		if len(b) > remain {
+			b = b[:remain]
+		}
+		rw.body = append(rw.body, b...)
+	}
+}
+
+func (rw *responseWriter) flush() {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (rw *responseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := rw.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil && !rw.wroteHeader {
+		rw.status = http.StatusSwitchingProtocols
+		rw.wroteHeader = true
+	}
+	return conn, buf, err
+}
+
+func (rw *responseWriter) push(target string, opts *http.PushOptions) error {
+	return rw.ResponseWriter.(http.Pusher).Push(target, opts)
+}
+
+type flushFunc func()
+
+func (f flushFunc) Flush() { f() }
+
+type hijackFunc func() (net.Conn, *bufio.ReadWriter, error)
+
+func (f hijackFunc) Hijack() (net.Conn, *bufio.ReadWriter, error) { return f() }
+
+type pushFunc func(target string, opts *http.PushOptions) error
+
+func (f pushFunc) Push(target string, opts *http.PushOptions) error { return f(target, opts) }
+
+// writer 返回传给下一个handler的http.ResponseWriter,
+// 只有被包装的writer支持时才实现http.Flusher, http.Hijacker, http.Pusher, 类型断言的结果与原writer一致.
+func (rw *responseWriter) writer() http.ResponseWriter {
+	_, isFlusher := rw.ResponseWriter.(http.Flusher)
+	_, isHijacker := rw.ResponseWriter.(http.Hijacker)
+	_, isPusher := rw.ResponseWriter.(http.Pusher)
+	flush, hijack, push := flushFunc(rw.flush), hijackFunc(rw.hijack), pushFunc(rw.push)
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{rw, flush, hijack, push}
+	case isFlusher && isHijacker:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{rw, flush, hijack}
+	case isFlusher && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{rw, flush, push}
+	case isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{rw, hijack, push}
+	case isFlusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{rw, flush}
+	case isHijacker:
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{rw, hijack}
+	case isPusher:
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{rw, push}
+	default:
+		return rw
+	}
+}
+
+// ReadFrom implements io.ReaderFrom, the wrapped writer's ReadFrom (e.g. sendfile)
+// is used directly once the body no longer needs to be captured.
+func (rw *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rf, ok := rw.ResponseWriter.(io.ReaderFrom)
+	if !ok || len(rw.body) < rw.maxBody {
+		return io.Copy(writerOnly{rw}, src)
+	}
+	n, err := rf.ReadFrom(src)
+	rw.size += int(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped http.ResponseWriter, used by http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// writerOnly hides the ReadFrom method of responseWriter to avoid io.Copy recursion.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,93 @@
+package hutils
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseWriterCapture(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	rw := wrapResponseWriter(recorder, 4)
+	assert.Equal(t, http.StatusOK, rw.Status())
+
+	rw.WriteHeader(http.StatusCreated)
+	rw.WriteHeader(http.StatusBadRequest)
+	n, err := rw.Write([]byte("123456"))
+	assert.NoError(t, err)
+	assert.Equal(t, 6, n)
+	assert.Equal(t, http.StatusCreated, rw.Status())
+	assert.Equal(t, http.StatusCreated, recorder.Code)
+	assert.Equal(t, "123456", recorder.Body.String())
+	assert.Equal(t, "1234", string(rw.body))
+	assert.Equal(t, 6, rw.size)
+
+	// 不记录响应内容时不缓存
+	rw = wrapResponseWriter(httptest.NewRecorder(), 0)
+	rw.Write([]byte("123456"))
+	assert.Empty(t, rw.body)
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	rw := wrapResponseWriter(recorder, MaxCaptureBodySize)
+	w := rw.writer()
+
+	flusher, ok := w.(http.Flusher)
+	assert.True(t, ok)
+	flusher.Flush()
+	assert.True(t, recorder.Flushed)
+
+	// httptest.ResponseRecorder不支持Hijack和Push, 包装后也不支持
+	_, ok = w.(http.Hijacker)
+	assert.False(t, ok)
+	_, ok = w.(http.Pusher)
+	assert.False(t, ok)
+
+	n, err := w.(io.ReaderFrom).ReadFrom(strings.NewReader("OK"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "OK", string(rw.body))
+	assert.Equal(t, "OK", recorder.Body.String())
+	assert.Equal(t, recorder, w.(interface{ Unwrap() http.ResponseWriter }).Unwrap())
+
+	// 只支持Hijack的writer
+	hijacker := &hijackRecorder{recorder: httptest.NewRecorder()}
+	rw = wrapResponseWriter(hijacker, 0)
+	w = rw.writer()
+	_, ok = w.(http.Flusher)
+	assert.False(t, ok)
+	_, _, err = w.(http.Hijacker).Hijack()
+	assert.NoError(t, err)
+	assert.True(t, hijacker.hijacked)
+	assert.Equal(t, http.StatusSwitchingProtocols, rw.Status())
+}
+
+// hijackRecorder 只实现http.Hijacker, 不实现http.Flusher
+type hijackRecorder struct {
+	recorder *httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Header() http.Header {
+	return h.recorder.Header()
+}
+
+func (h *hijackRecorder) Write(b []byte) (int, error) {
+	return h.recorder.Write(b)
+}
+
+func (h *hijackRecorder) WriteHeader(code int) {
+	h.recorder.WriteHeader(code)
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
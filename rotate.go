@@ -0,0 +1,117 @@
+package hutils
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	rotateLogs "github.com/lestrrat-go/file-rotatelogs"
+)
+
+const (
+	defaultRotationTime = time.Hour * 24
+	defaultMaxAge       = time.Hour * 24 * 30
+)
+
+// rotationClock 判断切割时间使用的时钟, 测试时替换
+var rotationClock rotateLogs.Clock = rotateLogs.Local
+
+// RotationOpt 日志文件切割配置
+type RotationOpt struct {
+	// Pattern 切割后的文件名, 相对于LogPath, 支持strftime格式, 如: access.%Y%m%d%H.log.
+	// 默认为<Type>.log.%Y-%m-%d, 按小时切割时为<Type>.log.%Y-%m-%d-%H
+	Pattern string
+	// RotationTime 按时间切割的间隔, 默认24小时
+	RotationTime time.Duration
+	// MaxSize 单个文件超过MaxSize字节时切割, 0表示不按大小切割
+	MaxSize int64
+	// MaxAge 切割后的文件保留时长, 与MaxBackups只能设置一个, 都未设置时保留30天
+	MaxAge time.Duration
+	// MaxBackups 切割后的文件保留个数
+	MaxBackups uint
+	// Compress 使用gzip压缩切割后的文件
+	Compress bool
+}
+
+// HourlyRotation 按小时切割, 保留maxAge时长
+func HourlyRotation(maxAge time.Duration) *RotationOpt {
+	return &RotationOpt{RotationTime: time.Hour, MaxAge: maxAge}
+}
+
+func (l *Logger) fileRotateWriter(opt *RotationOpt) (io.Writer, error) {
+	if opt == nil {
+		opt = &RotationOpt{}
+	}
+	filePath := l.filePath()
+	rotationTime := opt.RotationTime
+	if rotationTime <= 0 {
+		rotationTime = defaultRotationTime
+	}
+	pattern := filePath + ".%Y-%m-%d"
+	if rotationTime < defaultRotationTime {
+		pattern += "-%H"
+	}
+	if opt.Pattern != "" {
+		pattern = filepath.Join(l.LogPath, opt.Pattern)
+	}
+	options := []rotateLogs.Option{
+		rotateLogs.WithLinkName(filePath),
+		rotateLogs.WithRotationTime(rotationTime),
+		rotateLogs.WithClock(rotationClock),
+	}
+	// MaxAge与MaxBackups都设置时由rotatelogs返回错误
+	if opt.MaxAge > 0 {
+		options = append(options, rotateLogs.WithMaxAge(opt.MaxAge))
+	}
+	if opt.MaxBackups > 0 {
+		options = append(options, rotateLogs.WithRotationCount(opt.MaxBackups))
+	}
+	if opt.MaxAge <= 0 && opt.MaxBackups == 0 {
+		options = append(options, rotateLogs.WithMaxAge(defaultMaxAge))
+	}
+	if opt.MaxSize > 0 {
+		options = append(options, rotateLogs.WithRotationSize(opt.MaxSize))
+	}
+	if opt.Compress {
+		options = append(options, rotateLogs.WithHandler(rotateLogs.HandlerFunc(compressRotated)))
+	}
+	return rotateLogs.New(pattern, options...)
+}
+
+// compressRotated 压缩切割后的文件
+func compressRotated(e rotateLogs.Event) {
+	event, ok := e.(*rotateLogs.FileRotatedEvent)
+	if !ok || event.PreviousFile() == "" {
+		return
+	}
+	if err := gzipFile(event.PreviousFile()); err != nil {
+		log.Println(err)
+	}
+}
+
+func gzipFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,109 @@
+package hutils
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rotateLogs "github.com/lestrrat-go/file-rotatelogs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotationSize(t *testing.T) {
+	path, err := ioutil.TempDir("", "logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	logger := &Logger{LogPath: path, Type: ACCESS}
+	zapLogger, err := logger.Build(LoggerOpt{
+		EnableFile: true,
+		Rotation:   &RotationOpt{Pattern: "access.%Y%m%d.log", MaxSize: 64, MaxBackups: 10, Compress: true},
+	})
+	assert.NoError(t, err)
+	sugarLog := zapLogger.Sugar()
+	for i := 0; i < 3; i++ {
+		sugarLog.Info(strings.Repeat("x", 64))
+	}
+
+	// 压缩在rotatelogs的handler goroutine中执行
+	var compressed []string
+	require.Eventually(t, func() bool {
+		compressed, _ = filepath.Glob(filepath.Join(path, "access.*.log*.gz"))
+		return len(compressed) > 0
+	}, time.Second, 10*time.Millisecond)
+	require.NotEmpty(t, compressed)
+	f, err := os.Open(compressed[0])
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), strings.Repeat("x", 64))
+
+	_, err = os.Lstat(filepath.Join(path, "access.log"))
+	assert.NoError(t, err)
+}
+
+func TestRotationError(t *testing.T) {
+	path, err := ioutil.TempDir("", "logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	logger := &Logger{LogPath: path, Type: ACCESS}
+	_, err = logger.Build(LoggerOpt{
+		EnableFile: true,
+		Rotation:   &RotationOpt{MaxAge: time.Hour, MaxBackups: 3},
+	})
+	assert.Error(t, err)
+	assert.Panics(t, func() {
+		logger.Init(LoggerOpt{EnableFile: true, Rotation: &RotationOpt{MaxAge: time.Hour, MaxBackups: 3}})
+	})
+
+	_, err = logger.Build(LoggerOpt{EnableFile: true, Rotation: HourlyRotation(time.Hour * 24)})
+	assert.NoError(t, err)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestHourlyRotation(t *testing.T) {
+	path, err := ioutil.TempDir("", "logs")
+	require.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	clock := &fakeClock{now: time.Date(2022, 3, 1, 10, 30, 0, 0, time.Local)}
+	rotationClock = clock
+	defer func() { rotationClock = rotateLogs.Local }()
+
+	logger := &Logger{LogPath: path, Type: ACCESS}
+	zapLogger, err := logger.Build(LoggerOpt{EnableFile: true, Rotation: HourlyRotation(time.Hour * 24)})
+	require.NoError(t, err)
+	sugarLog := zapLogger.Sugar()
+	sugarLog.Info("before cutover")
+	clock.now = clock.now.Add(time.Hour)
+	sugarLog.Info("after cutover")
+
+	before, err := ioutil.ReadFile(filepath.Join(path, "access.log.2022-03-01-10"))
+	require.NoError(t, err)
+	assert.Contains(t, string(before), "before cutover")
+	assert.NotContains(t, string(before), "after cutover")
+	after, err := ioutil.ReadFile(filepath.Join(path, "access.log.2022-03-01-11"))
+	require.NoError(t, err)
+	assert.Contains(t, string(after), "after cutover")
+
+	// 软链接指向当前小时的文件
+	link, err := os.Readlink(filepath.Join(path, "access.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "access.log.2022-03-01-11", filepath.Base(link))
+}
@@ -0,0 +1,138 @@
+package hutils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/SkyAPM/go2sky"
+	v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+var (
+	ComponentIDGOHttpClient int32 = 5005
+)
+
+// roundTripper 为http请求创建skywalking exit span, 复用handler的配置
+type roundTripper struct {
+	handler
+	next http.RoundTripper
+}
+
+// NewClientSkywalkingHTTPRoundTripper 返回带skywalking追踪的http.RoundTripper, next为nil时使用http.DefaultTransport.
+// 支持WithFilterURL, WithOperation, WithExtraTags, WithHTTPRedactor, WithHTTPPayloadLimiter.
+// 记录响应内容时会预读响应, 流式响应(如text/event-stream)需要通过WithHTTPPayloadLimiter跳过.
+func NewClientSkywalkingHTTPRoundTripper(tracer *go2sky.Tracer, next http.RoundTripper, opts ...func(*handler)) (http.RoundTripper, error) {
+	if tracer == nil {
+		return nil, errors.New("tracer is nil")
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &roundTripper{
+		handler: handler{
+			tracer: tracer,
+			operationFunc: func(name string, r *http.Request) string {
+				if name != "" {
+					return name
+				}
+				return r.URL.Path
+			},
+		},
+		next: next,
+	}
+	for _, o := range opts {
+		o(&t.handler)
+	}
+	return t, nil
+}
+
+func (t *roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	if FilterURL(t.filterURLs, r.URL.Path) {
+		return t.next.RoundTrip(r)
+	}
+	// RoundTrip不应修改原始请求
+	req := r.Clone(r.Context())
+	span, err := t.tracer.CreateExitSpan(r.Context(), t.operationFunc(t.name, r), r.URL.Host, func(key, value string) error {
+		req.Header.Set(key, value)
+		return nil
+	})
+	if err != nil {
+		return t.next.RoundTrip(r)
+	}
+	defer span.End()
+	span.SetComponent(ComponentIDGOHttpClient)
+	span.SetSpanLayer(v3.SpanLayer_Http)
+	span.Tag(go2sky.TagHTTPMethod, r.Method)
+	span.Tag(go2sky.TagURL, redactURL(r.URL, t.redactor))
+	for k, v := range t.extraTags {
+		span.Tag(go2sky.Tag(k), v)
+	}
+
+	logPayload := !t.payloadLimiter.SkipMethod(r.Method, r.URL.Path) && t.payloadLimiter.Sampled()
+	if logPayload && req.Body != nil && req.Body != http.NoBody && !t.payloadLimiter.SkipContentType(req.Header.Get("Content-Type")) {
+		span.Log(time.Now(), ReqTag, Param(t.readRequestBody(req)))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.Error(time.Now(), RespTag, err.Error())
+		return resp, err
+	}
+	span.Tag(go2sky.TagStatusCode, strconv.Itoa(resp.StatusCode))
+	var body string
+	if logPayload && !t.payloadLimiter.SkipContentType(resp.Header.Get("Content-Type")) {
+		body = t.readResponseBody(resp)
+	}
+	if resp.StatusCode >= 400 {
+		span.Error(time.Now(), RespTag, body)
+	} else if body != "" {
+		span.Log(time.Now(), RespTag, body)
+	}
+	return resp, nil
+}
+
+// readRequestBody 预读最多MaxCaptureBodySize字节的请求内容, 并还原req.Body
+func (t *roundTripper) readRequestBody(req *http.Request) []byte {
+	buf, err := io.ReadAll(io.LimitReader(req.Body, int64(MaxCaptureBodySize)))
+	if err != nil {
+		log.Println(err)
+	}
+	req.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(buf), req.Body), Closer: req.Body}
+	size := len(buf)
+	if req.ContentLength > int64(size) {
+		size = int(req.ContentLength)
+	}
+	return t.payloadLimiter.truncate(t.redactor.redactPayload(buf), size)
+}
+
+// readResponseBody 预读最多MaxCaptureBodySize字节的响应内容, 并还原resp.Body
+func (t *roundTripper) readResponseBody(resp *http.Response) string {
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, int64(MaxCaptureBodySize)))
+	if err != nil {
+		log.Println(err)
+	}
+	resp.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(buf), resp.Body), Closer: resp.Body}
+	size := len(buf)
+	if resp.ContentLength > int64(size) {
+		size = int(resp.ContentLength)
+	}
+	return string(t.payloadLimiter.truncate(t.redactor.redactPayload(buf), size))
+}
+
+// redactURL 隐藏url中的密码并对query脱敏
+func redactURL(u *url.URL, redactor *Redactor) string {
+	redacted := *u
+	redacted.RawQuery = redactor.RedactQuery(u.RawQuery)
+	return redacted.Redacted()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
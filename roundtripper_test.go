@@ -0,0 +1,101 @@
+package hutils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SkyAPM/go2sky"
+	"github.com/SkyAPM/go2sky/propagation"
+	"github.com/stretchr/testify/assert"
+	v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+func TestClientSkywalkingHTTPRoundTripper(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 需要注入sw8 header
+		assert.NotEmpty(t, r.Header.Get(propagation.Header))
+		payload, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 1)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+	_, err = NewClientSkywalkingHTTPRoundTripper(nil, nil)
+	assert.Error(t, err)
+	transport, err := NewClientSkywalkingHTTPRoundTripper(tracer, nil,
+		WithHTTPRedactor(NewRedactor(RedactField("phone", MaskAll), RedactField("token", MaskAll))),
+	)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequest("POST", server.URL+"/users?token=secret", strings.NewReader(`{"phone":"13812345678"}`))
+	assert.NoError(t, err)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	// 预读后响应内容仍然完整
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"phone":"13812345678"}`, string(body))
+	assert.Empty(t, req.Header.Get(propagation.Header))
+
+	span := <-recorder.spans
+	assert.Equal(t, v3.SpanType_Exit, span.SpanType())
+	assert.Equal(t, "/users", span.OperationName())
+	assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), span.Peer())
+	assert.True(t, span.IsError())
+	logs := span.Logs()
+	assert.Len(t, logs, 2)
+	assert.Equal(t, `{"phone":"***********"}`, logs[0].Data[0].Value)
+	// url中的query同样需要脱敏
+	var spanURL string
+	for _, tag := range span.Tags() {
+		if tag.Key == string(go2sky.TagURL) {
+			spanURL = tag.Value
+		}
+	}
+	assert.Equal(t, server.URL+"/users?token=******", spanURL)
+}
+
+func TestClientSkywalkingHTTPRoundTripperOversizedBody(t *testing.T) {
+	body := `{"remark":"` + strings.Repeat("x", 50) + `","phone":"13812345678"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		payload, _ := io.ReadAll(r.Body)
+		assert.Equal(t, body, string(payload))
+		w.Write(payload)
+	}))
+	defer server.Close()
+
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 1)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+	transport, err := NewClientSkywalkingHTTPRoundTripper(tracer, nil,
+		WithHTTPRedactor(NewRedactor(RedactField("phone", MaskAll))),
+		WithHTTPPayloadLimiter(NewPayloadLimiter(LimitPayloadSize(40))),
+	)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: transport}
+
+	// 超出MaxCaptureBodySize的json无法解析, 不记录原内容
+	defer func(size int) { MaxCaptureBodySize = size }(MaxCaptureBodySize)
+	MaxCaptureBodySize = 80
+	resp, err := client.Post(server.URL+"/users", "application/json", strings.NewReader(body))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(b))
+
+	span := <-recorder.spans
+	logs := span.Logs()
+	assert.Len(t, logs, 2)
+	for _, l := range logs {
+		assert.Equal(t, "<redacted: unparseable>...(truncated, 85 bytes)", l.Data[0].Value)
+	}
+}
@@ -0,0 +1,109 @@
+package hutils
+
+import (
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// union模式下TRACK, ERROR对应的级别: UnionLog.Track为Debug, UnionLog.Error为Error
+var logTypeLevels = map[LogType][]zapcore.Level{
+	TRACK: {zapcore.DebugLevel},
+	ERROR: {zapcore.ErrorLevel, zapcore.DPanicLevel, zapcore.PanicLevel, zapcore.FatalLevel},
+}
+
+// logTypeKey AccessLog, RequestLog, UnionLog.Log附加的LogType标记, 不会被encoder输出, 只用于LogRoute
+const logTypeKey = "hutils_log_type"
+
+func logTypeField(logType LogType) zap.Field {
+	return zap.Field{Key: logTypeKey, Type: zapcore.SkipType, String: string(logType)}
+}
+
+// fieldsLogType 从字段中获取LogType标记, 没有时返回logType
+func fieldsLogType(logType LogType, fields []zapcore.Field) LogType {
+	for _, f := range fields {
+		if f.Key == logTypeKey && f.Type == zapcore.SkipType {
+			logType = LogType(f.String)
+		}
+	}
+	return logType
+}
+
+// LogRoute union模式下将部分日志输出到单独的writer, 匹配的日志不再写入默认输出.
+// 如错误日志同时输出到stdout和error.log: LogRoute{Type: ERROR, EnableStdout: true}
+type LogRoute struct {
+	// Type 写入LogPath下的<Type>.log, 与Logger.Type的文件一致, 为空时不写文件
+	Type LogType
+	// Levels 匹配的级别, 为空时按Type匹配: ACCESS为AccessLog, UnionLog.Log, REQUEST为RequestLog, TRACK为Debug, ERROR为Error及以上
+	Levels       []zapcore.Level
+	EnableStdout bool
+	Writers      []zapcore.WriteSyncer
+}
+
+// match logType为日志的LogType标记, 没有标记时为空
+func (r LogRoute) match(lev zapcore.Level, logType LogType) bool {
+	levels := r.Levels
+	if len(levels) == 0 {
+		if r.Type == ACCESS || r.Type == REQUEST {
+			return logType == r.Type
+		}
+		levels = logTypeLevels[r.Type]
+	}
+	for _, level := range levels {
+		if level == lev {
+			return true
+		}
+	}
+	return false
+}
+
+// routeCore 按日志级别和LogType标记过滤写入的日志, 标记在字段中, 只能在Write时判断
+type routeCore struct {
+	zapcore.Core
+	logType LogType
+	match   func(lev zapcore.Level, logType LogType) bool
+}
+
+func (c *routeCore) With(fields []zapcore.Field) zapcore.Core {
+	return &routeCore{Core: c.Core.With(fields), logType: fieldsLogType(c.logType, fields), match: c.match}
+}
+
+func (c *routeCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *routeCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.match(ent.Level, fieldsLogType(c.logType, fields)) {
+		return nil
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// newWriter 组合stdout, <fileType>.log以及其他writer, 开启Async时异步写入
+func (l *Logger) newWriter(opt LoggerOpt, stdout bool, fileType LogType, others []zapcore.WriteSyncer) (zapcore.WriteSyncer, error) {
+	var writers []zapcore.WriteSyncer
+	if stdout {
+		writers = append(writers, zapcore.AddSync(os.Stdout))
+	}
+	if fileType != "" {
+		fileLogger := &Logger{Type: fileType, LogPath: l.LogPath}
+		writer, err := fileLogger.fileRotateWriter(opt.Rotation)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, zapcore.AddSync(writer))
+	}
+	writers = append(writers, others...)
+	l.sinks = append(l.sinks, others...)
+	writer := zapcore.NewMultiWriteSyncer(writers...)
+	if opt.Async != nil {
+		async := NewAsyncWriteSyncer(writer, *opt.Async)
+		l.asyncs = append(l.asyncs, async)
+		writer = async
+	}
+	return writer, nil
+}
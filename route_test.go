@@ -0,0 +1,104 @@
+package hutils
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogRoutes(t *testing.T) {
+	path, err := ioutil.TempDir("", "logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	output, err := CaptureStdout(func() {
+		logger := &Logger{Type: UNION, LogPath: path}
+		sugarLog, err := logger.Build(LoggerOpt{
+			EnableStdout: true,
+			IsUnion:      true,
+			Routes: []LogRoute{
+				{Type: ERROR, EnableStdout: true},
+				{Type: ACCESS},
+			},
+		})
+		assert.NoError(t, err)
+		l := UnionLog{Request: "/ping"}
+		l.Log(context.Background(), sugarLog.Sugar())
+		l.Error(context.Background(), sugarLog.Sugar(), errors.New("TestLogRoutes error"))
+		l.Track(context.Background(), sugarLog.Sugar(), "TestLogRoutes track")
+		_ = sugarLog.Sync()
+	})
+	assert.NoError(t, err)
+	stdout := strings.Join(output, "\n")
+	// 错误日志同时输出到stdout和error.log, 访问日志只输出到access.log, 未匹配的track使用默认输出
+	assert.Contains(t, stdout, "TestLogRoutes error")
+	assert.Contains(t, stdout, "TestLogRoutes track")
+	assert.NotContains(t, stdout, "/ping")
+
+	errorLog, err := ioutil.ReadFile(filepath.Join(path, "error.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(errorLog), "TestLogRoutes error")
+	assert.NotContains(t, string(errorLog), "/ping")
+	accessLog, err := ioutil.ReadFile(filepath.Join(path, "access.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(accessLog), "/ping")
+	assert.NotContains(t, string(accessLog), "TestLogRoutes")
+}
+
+func TestLogRoutesAccessRequest(t *testing.T) {
+	path, err := ioutil.TempDir("", "logs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+
+	output, err := CaptureStdout(func() {
+		logger := &Logger{Type: UNION, LogPath: path}
+		sugarLog := logger.Init(LoggerOpt{
+			EnableStdout: true,
+			IsUnion:      true,
+			Routes:       []LogRoute{{Type: ACCESS}, {Type: REQUEST}},
+		}).Sugar()
+		AccessLog{Request: "/access-path"}.Log(sugarLog)
+		RequestLog{Request: "/request-path"}.LogWithContext(context.Background(), sugarLog)
+		SetLegacyLogFormat(true)
+		AccessLog{Request: "/legacy-access-path"}.Log(sugarLog)
+		RequestLog{Request: "/legacy-request-path"}.Log(sugarLog)
+		SetLegacyLogFormat(false)
+		sugarLog.Info("TestLogRoutesAccessRequest info")
+		_ = sugarLog.Sync()
+	})
+	assert.NoError(t, err)
+	// 没有标记的Info日志使用默认输出
+	stdout := strings.Join(output, "\n")
+	assert.Contains(t, stdout, "TestLogRoutesAccessRequest info")
+	assert.NotContains(t, stdout, "-path")
+
+	accessLog, err := ioutil.ReadFile(filepath.Join(path, "access.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(accessLog), "/access-path")
+	assert.Contains(t, string(accessLog), "/legacy-access-path")
+	assert.NotContains(t, string(accessLog), "request-path")
+	assert.NotContains(t, string(accessLog), "hutils_log_type")
+	requestLog, err := ioutil.ReadFile(filepath.Join(path, "request.log"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(requestLog), "/request-path")
+	assert.Contains(t, string(requestLog), "/legacy-request-path")
+	assert.NotContains(t, string(requestLog), "access-path")
+	assert.NotContains(t, string(requestLog), "TestLogRoutesAccessRequest")
+}
+
+func TestLogRouteMatch(t *testing.T) {
+	assert.True(t, LogRoute{Type: ERROR}.match(zapcore.FatalLevel, ""))
+	assert.False(t, LogRoute{Type: ERROR}.match(zapcore.WarnLevel, ""))
+	assert.True(t, LogRoute{Type: ACCESS}.match(zapcore.InfoLevel, ACCESS))
+	assert.False(t, LogRoute{Type: ACCESS}.match(zapcore.InfoLevel, REQUEST))
+	assert.False(t, LogRoute{Type: REQUEST}.match(zapcore.InfoLevel, ""))
+	assert.True(t, LogRoute{Type: TRACK, Levels: []zapcore.Level{zapcore.WarnLevel}}.match(zapcore.WarnLevel, ""))
+	assert.False(t, LogRoute{Type: TRACK, Levels: []zapcore.Level{zapcore.WarnLevel}}.match(zapcore.DebugLevel, ""))
+}
@@ -0,0 +1,708 @@
+package hutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSinkBatchSize     = 100
+	defaultSinkFlushInterval = time.Second
+	defaultSinkMaxRetries    = 3
+	defaultSinkBackoff       = 100 * time.Millisecond
+	defaultSinkMaxBackoff    = 5 * time.Second
+	defaultSinkTimeout       = 5 * time.Second
+	defaultSinkSpoolSize     = 64 << 20
+)
+
+// ErrSinkClosed 写入已关闭的Sink
+var ErrSinkClosed = errors.New("hutils: sink closed")
+
+// syslogTimeLayout RFC 5424 TIMESTAMP, TIME-SECFRAC最多6位
+const syslogTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// sinkEntry 一条日志及其写入Sink的时间, 批量发送、重试以及从spool重新发送时使用该时间
+type sinkEntry struct {
+	time time.Time
+	data []byte
+}
+
+// BulkFormat http批量发送的格式
+type BulkFormat int
+
+const (
+	// BulkElasticsearch Elasticsearch _bulk接口, 非json格式的日志会放在message字段中
+	BulkElasticsearch BulkFormat = iota
+	// BulkLoki Loki /loki/api/v1/push接口
+	BulkLoki
+)
+
+// nolint: govet
+type sinkOptions struct {
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+	timeout       time.Duration
+	// 发送失败的日志写入该文件, 恢复后重新发送.
+	spoolPath string
+	spoolSize int64
+	// syslog.
+	facility int
+	appName  string
+	hostname string
+	// http.
+	client  *http.Client
+	headers map[string]string
+	index   string
+	labels  map[string]string
+}
+
+type SinkOption func(*sinkOptions)
+
+// WithSinkBatch 累计size条日志或每隔interval发送一次
+func WithSinkBatch(size int, interval time.Duration) SinkOption {
+	return func(o *sinkOptions) {
+		o.batchSize = size
+		o.flushInterval = interval
+	}
+}
+
+// WithSinkRetry 发送失败时最多重试maxRetries次, 间隔从backoff开始翻倍, 不超过maxBackoff
+func WithSinkRetry(maxRetries int, backoff, maxBackoff time.Duration) SinkOption {
+	return func(o *sinkOptions) {
+		o.maxRetries = maxRetries
+		o.backoff = backoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithSinkTimeout 连接、发送的超时时间
+func WithSinkTimeout(timeout time.Duration) SinkOption {
+	return func(o *sinkOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithSinkSpool 重试后仍发送失败的日志写入path, 下次发送时优先按批重新发送, 未设置时丢弃
+func WithSinkSpool(path string) SinkOption {
+	return func(o *sinkOptions) {
+		o.spoolPath = path
+	}
+}
+
+// WithSinkSpoolSize spool文件的最大字节数, 超过后丢弃新的日志, 默认64MB
+func WithSinkSpoolSize(size int64) SinkOption {
+	return func(o *sinkOptions) {
+		o.spoolSize = size
+	}
+}
+
+// WithSyslogFacility syslog facility, 默认为1(user-level)
+func WithSyslogFacility(facility int) SinkOption {
+	return func(o *sinkOptions) {
+		o.facility = facility
+	}
+}
+
+// WithSyslogAppName syslog APP-NAME, 默认为服务名
+func WithSyslogAppName(appName string) SinkOption {
+	return func(o *sinkOptions) {
+		o.appName = appName
+	}
+}
+
+// WithSinkHTTPClient http批量发送使用的client
+func WithSinkHTTPClient(client *http.Client) SinkOption {
+	return func(o *sinkOptions) {
+		o.client = client
+	}
+}
+
+// WithSinkHeaders http批量发送时附加的header, 如Authorization
+func WithSinkHeaders(headers map[string]string) SinkOption {
+	return func(o *sinkOptions) {
+		o.headers = headers
+	}
+}
+
+// WithBulkIndex Elasticsearch索引名, 默认为服务名
+func WithBulkIndex(index string) SinkOption {
+	return func(o *sinkOptions) {
+		o.index = index
+	}
+}
+
+// WithLokiLabels Loki stream labels, 默认为{"service": 服务名}
+func WithLokiLabels(labels map[string]string) SinkOption {
+	return func(o *sinkOptions) {
+		o.labels = labels
+	}
+}
+
+func newSinkOptions(opts ...SinkOption) sinkOptions {
+	hostname, _ := os.Hostname()
+	o := sinkOptions{
+		batchSize:     defaultSinkBatchSize,
+		flushInterval: defaultSinkFlushInterval,
+		maxRetries:    defaultSinkMaxRetries,
+		backoff:       defaultSinkBackoff,
+		maxBackoff:    defaultSinkMaxBackoff,
+		timeout:       defaultSinkTimeout,
+		spoolSize:     defaultSinkSpoolSize,
+		facility:      1,
+		appName:       serviceName,
+		hostname:      hostname,
+		index:         serviceName,
+		labels:        map[string]string{"service": serviceName},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.client == nil {
+		o.client = &http.Client{Timeout: o.timeout}
+	}
+	return o
+}
+
+// Sink 批量发送日志的zapcore.WriteSyncer, 通过LoggerOpt.Sinks使用.
+// 每次Write为一条日志, 包装Sink的writer需要保持Write的边界(AsyncWriteSyncer会逐条写入),
+// 发送失败时按退避重试, 仍失败时写入spool文件.
+type Sink struct {
+	opts sinkOptions
+	send func(entries []sinkEntry) error
+
+	mu      sync.Mutex
+	entries []sinkEntry
+	closed  bool
+	// 串行发送, 保证日志顺序
+	sendMu sync.Mutex
+	full   chan struct{}
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newSink(send func(entries []sinkEntry) error, opts sinkOptions) *Sink {
+	s := &Sink{
+		opts: opts,
+		send: send,
+		full: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Write 缓存一条日志并记录写入时间, Close之后返回ErrSinkClosed
+func (s *Sink) Write(p []byte) (int, error) {
+	entry := sinkEntry{time: time.Now(), data: append([]byte(nil), bytes.TrimRight(p, "\n")...)}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, ErrSinkClosed
+	}
+	s.entries = append(s.entries, entry)
+	full := len(s.entries) >= s.opts.batchSize
+	s.mu.Unlock()
+	if full {
+		select {
+		case s.full <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Sync 立即发送缓存的日志
+func (s *Sink) Sync() error {
+	return s.flush()
+}
+
+// Close 发送剩余的日志并停止后台goroutine, 之后的写入返回ErrSinkClosed
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.done)
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return s.flush()
+}
+
+func (s *Sink) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		case <-s.full:
+		}
+		if err := s.flush(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+func (s *Sink) flush() error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+	s.mu.Lock()
+	entries := s.entries
+	s.entries = nil
+	s.mu.Unlock()
+
+	if err := s.replaySpool(); err != nil {
+		// spool中的日志还没有发送成功, 为保证顺序新的日志也写入spool
+		return s.spool(entries, err)
+	}
+	var dropErr error
+	for len(entries) > 0 {
+		n := len(entries)
+		if n > s.opts.batchSize {
+			n = s.opts.batchSize
+		}
+		remaining, err := s.sendWithRetry(entries[:n])
+		if len(remaining) > 0 {
+			return s.spool(append(append([]sinkEntry(nil), remaining...), entries[n:]...), err)
+		}
+		if err != nil {
+			dropErr = err
+		}
+		entries = entries[n:]
+	}
+	return dropErr
+}
+
+// sendError 部分日志已经发送成功或无法重试时返回, 重试时只发送remaining, dropped为无法重试被丢弃的条数
+type sendError struct {
+	remaining []sinkEntry
+	dropped   int
+	err       error
+}
+
+func (e *sendError) Error() string {
+	return e.err.Error()
+}
+
+func (e *sendError) Unwrap() error {
+	return e.err
+}
+
+// sendWithRetry 返回重试后仍未发送成功的日志, 无法重试的日志会被丢弃, 只返回错误
+func (s *Sink) sendWithRetry(entries []sinkEntry) ([]sinkEntry, error) {
+	backoff := s.opts.backoff
+	var dropErr error
+	for attempt := 0; ; attempt++ {
+		err := s.send(entries)
+		if err == nil {
+			return nil, dropErr
+		}
+		var partial *sendError
+		if errors.As(err, &partial) {
+			entries = partial.remaining
+			if partial.dropped > 0 {
+				dropErr = err
+			}
+		}
+		if len(entries) == 0 || attempt >= s.opts.maxRetries {
+			return entries, err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > s.opts.maxBackoff {
+			backoff = s.opts.maxBackoff
+		}
+	}
+}
+
+// spool 发送失败的日志写入spool文件, 未设置spool时丢弃
+func (s *Sink) spool(entries []sinkEntry, err error) error {
+	if len(entries) == 0 {
+		return err
+	}
+	if s.opts.spoolPath == "" {
+		return fmt.Errorf("hutils: drop %d log entries: %w", len(entries), err)
+	}
+	if spoolErr := s.writeSpool(entries); spoolErr != nil {
+		return fmt.Errorf("hutils: spool log entries: %w", spoolErr)
+	}
+	return err
+}
+
+// spoolRecord spool文件中的一行, 日志本身可能包含换行
+type spoolRecord struct {
+	Time  time.Time `json:"time"`
+	Entry string    `json:"entry"`
+}
+
+// spool文件每行为一条json, 保留日志写入Sink的时间
+func spoolLine(entry sinkEntry) []byte {
+	line, _ := json.Marshal(spoolRecord{Time: entry.time, Entry: string(entry.data)})
+	return append(line, '\n')
+}
+
+// parseSpoolLine 解析spool中的一行, 兼容旧版本只保存日志内容的json字符串, 此时使用当前时间
+func parseSpoolLine(line []byte) (sinkEntry, bool) {
+	var record spoolRecord
+	if err := json.Unmarshal(line, &record); err == nil {
+		return sinkEntry{time: record.Time, data: []byte(record.Entry)}, true
+	}
+	var entry string
+	if err := json.Unmarshal(line, &entry); err == nil {
+		return sinkEntry{time: time.Now(), data: []byte(entry)}, true
+	}
+	return sinkEntry{}, false
+}
+
+// writeSpool 追加到spool文件, 超过spoolSize的日志会被丢弃
+func (s *Sink) writeSpool(entries []sinkEntry) error {
+	f, err := os.OpenFile(s.opts.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	size, dropped := info.Size(), 0
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		line := spoolLine(entry)
+		if size+int64(len(line)) > s.opts.spoolSize {
+			dropped++
+			continue
+		}
+		size += int64(len(line))
+		_, _ = w.Write(line)
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if dropped > 0 {
+		return fmt.Errorf("hutils: spool is full, drop %d log entries", dropped)
+	}
+	return nil
+}
+
+// replaySpool 按batchSize分批重新发送spool中的日志, 全部发送成功后删除spool文件.
+// 发送失败时只保留未发送成功的日志.
+func (s *Sink) replaySpool() error {
+	if s.opts.spoolPath == "" {
+		return nil
+	}
+	f, err := os.Open(s.opts.spoolPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var (
+		r                  = bufio.NewReader(f)
+		batch              []sinkEntry
+		offset, batchStart int64
+		dropErr            error
+	)
+	for {
+		line, readErr := r.ReadBytes('\n')
+		offset += int64(len(line))
+		if entry, ok := parseSpoolLine(line); ok {
+			batch = append(batch, entry)
+		}
+		if len(batch) > 0 && (len(batch) >= s.opts.batchSize || readErr != nil) {
+			remaining, err := s.sendWithRetry(batch)
+			if len(remaining) > 0 {
+				// 一条都没有发送成功时spool文件不需要修改
+				if batchStart == 0 && len(remaining) == len(batch) {
+					return err
+				}
+				if rewriteErr := s.rewriteSpool(f, remaining, offset); rewriteErr != nil {
+					log.Println(rewriteErr)
+				}
+				return err
+			}
+			if err != nil {
+				dropErr = err
+			}
+			batch, batchStart = nil, offset
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if dropErr != nil {
+		log.Println(dropErr)
+	}
+	f.Close()
+	return os.Remove(s.opts.spoolPath)
+}
+
+// rewriteSpool 将未发送成功的日志和spool中offset之后的内容写入新的spool文件
+func (s *Sink) rewriteSpool(f *os.File, remaining []sinkEntry, offset int64) error {
+	tmp := s.opts.spoolPath + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	for _, entry := range remaining {
+		_, _ = w.Write(spoolLine(entry))
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err == nil {
+		_, err = io.Copy(w, f)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	f.Close()
+	return os.Rename(tmp, s.opts.spoolPath)
+}
+
+// connSender 通过tcp/udp发送, 出错时关闭连接, 下次发送时从写入失败的日志开始重新发送
+type connSender struct {
+	network string
+	addr    string
+	timeout time.Duration
+	frame   func(entry sinkEntry) []byte
+	conn    net.Conn
+}
+
+func (c *connSender) send(entries []sinkEntry) error {
+	if c.conn == nil {
+		conn, err := net.DialTimeout(c.network, c.addr, c.timeout)
+		if err != nil {
+			return err
+		}
+		c.conn = conn
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	for i, entry := range entries {
+		if _, err := c.conn.Write(c.frame(entry)); err != nil {
+			c.conn.Close()
+			c.conn = nil
+			return &sendError{remaining: entries[i:], err: err}
+		}
+	}
+	return nil
+}
+
+// NewSyslogSink 按RFC 5424格式发送到syslog, network为udp或tcp, tcp使用RFC 6587 octet counting分帧.
+// 日志级别从日志内容中识别.
+func NewSyslogSink(network, addr string, opts ...SinkOption) *Sink {
+	o := newSinkOptions(opts...)
+	pid := strconv.Itoa(os.Getpid())
+	c := &connSender{network: network, addr: addr, timeout: o.timeout}
+	c.frame = func(entry sinkEntry) []byte {
+		msg := fmt.Sprintf("<%d>1 %s %s %s %s - - %s",
+			o.facility*8+syslogSeverity(entry.data), entry.time.Format(syslogTimeLayout),
+			syslogField(o.hostname), syslogField(o.appName), pid, entry.data)
+		if network == "udp" || network == "udp4" || network == "udp6" {
+			return []byte(msg)
+		}
+		return []byte(strconv.Itoa(len(msg)) + " " + msg)
+	}
+	return newSink(c.send, o)
+}
+
+// NewLineSink 每条日志一行, 通过tcp/udp发送, 适用于Logstash/Fluent Bit/Vector等的tcp、udp输入
+func NewLineSink(network, addr string, opts ...SinkOption) *Sink {
+	o := newSinkOptions(opts...)
+	c := &connSender{network: network, addr: addr, timeout: o.timeout}
+	c.frame = func(entry sinkEntry) []byte {
+		return append(append([]byte(nil), entry.data...), '\n')
+	}
+	return newSink(c.send, o)
+}
+
+// NewHTTPBulkSink 批量POST到Elasticsearch _bulk或Loki push接口, 非2xx响应视为失败.
+// Elasticsearch响应中errors为true时只重新发送失败的日志, 状态码不是429和5xx的日志无法重试, 会被丢弃.
+func NewHTTPBulkSink(url string, format BulkFormat, opts ...SinkOption) *Sink {
+	o := newSinkOptions(opts...)
+	contentType := "application/x-ndjson"
+	encode := o.elasticsearchBody
+	check := elasticsearchResult
+	if format == BulkLoki {
+		contentType = "application/json"
+		encode = o.lokiBody
+		check = func(entries []sinkEntry, body io.Reader) error {
+			return nil
+		}
+	}
+	send := func(entries []sinkEntry) error {
+		body, err := encode(entries)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range o.headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := o.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("hutils: bulk request failed with status %d", resp.StatusCode)
+		}
+		return check(entries, resp.Body)
+	}
+	return newSink(send, o)
+}
+
+// bulkResponse Elasticsearch _bulk响应, items与请求中的日志一一对应
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// elasticsearchResult 检查_bulk响应中每条日志的结果
+func elasticsearchResult(entries []sinkEntry, body io.Reader) error {
+	var resp bulkResponse
+	// 没有响应内容时视为成功
+	if err := json.NewDecoder(body).Decode(&resp); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("hutils: decode bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+	if len(resp.Items) != len(entries) {
+		return fmt.Errorf("hutils: bulk response has %d items for %d entries", len(resp.Items), len(entries))
+	}
+	var (
+		remaining []sinkEntry
+		failed    int
+		reason    json.RawMessage
+	)
+	for i, item := range resp.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 {
+				continue
+			}
+			failed++
+			if reason == nil {
+				reason = result.Error
+			}
+			if result.Status == http.StatusTooManyRequests || result.Status >= 500 {
+				remaining = append(remaining, entries[i])
+			}
+		}
+	}
+	return &sendError{
+		remaining: remaining,
+		dropped:   failed - len(remaining),
+		err:       fmt.Errorf("hutils: bulk request has %d failed items: %s", failed, reason),
+	}
+}
+
+func (o sinkOptions) elasticsearchBody(entries []sinkEntry) ([]byte, error) {
+	action, err := json.Marshal(map[string]map[string]string{"index": {"_index": o.index}})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		buf.Write(action)
+		buf.WriteByte('\n')
+		if json.Valid(entry.data) && bytes.HasPrefix(bytes.TrimSpace(entry.data), []byte("{")) {
+			buf.Write(entry.data)
+		} else {
+			doc, err := json.Marshal(map[string]string{
+				"@timestamp": entry.time.Format(time.RFC3339Nano),
+				"message":    string(entry.data),
+			})
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(doc)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+func (o sinkOptions) lokiBody(entries []sinkEntry) ([]byte, error) {
+	values := make([][2]string, len(entries))
+	for i, entry := range entries {
+		values[i] = [2]string{strconv.FormatInt(entry.time.UnixNano(), 10), string(entry.data)}
+	}
+	return json.Marshal(map[string]interface{}{
+		"streams": []map[string]interface{}{{
+			"stream": o.labels,
+			"values": values,
+		}},
+	})
+}
+
+// syslogSeverity 按日志中最先出现的zap级别确定syslog severity, 未识别时为informational
+func syslogSeverity(entry []byte) int {
+	head := entry
+	if len(head) > 256 {
+		head = head[:256]
+	}
+	severity, index := 6, -1
+	for _, level := range []struct {
+		name     string
+		severity int
+	}{
+		{"DEBUG", 7}, {"INFO", 6}, {"WARN", 4}, {"ERROR", 3},
+		{"DPANIC", 2}, {"PANIC", 2}, {"FATAL", 2},
+	} {
+		if i := bytes.Index(head, []byte(level.name)); i >= 0 && (index < 0 || i < index) {
+			severity, index = level.severity, i
+		}
+	}
+	return severity
+}
+
+// syslogField RFC 5424中空值使用-
+func syslogField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
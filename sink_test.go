@@ -0,0 +1,434 @@
+package hutils
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSyslogSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	received := make(chan string, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			// octet counting: MSG-LEN SP SYSLOG-MSG
+			size, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, _ := strconv.Atoi(strings.TrimSpace(size))
+			msg := make([]byte, n)
+			if _, err = io.ReadFull(r, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	sink := NewSyslogSink("tcp", listener.Addr().String(), WithSyslogAppName("app"))
+	_, _ = sink.Write([]byte("2022-01-01 00:00:00 INFO info\n"))
+	_, _ = sink.Write([]byte("2022-01-01 00:00:00 ERROR error\nstack$\n"))
+	assert.NoError(t, sink.Close())
+
+	info := <-received
+	assert.True(t, strings.HasPrefix(info, "<14>1 "), info)
+	// RFC 5424 TIME-SECFRAC最多6位
+	assert.Regexp(t, `^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}(Z|[+-]\d{2}:\d{2})$`, strings.Fields(info)[1])
+	assert.Contains(t, info, " app "+strconv.Itoa(os.Getpid())+" - - 2022-01-01 00:00:00 INFO info")
+	errMsg := <-received
+	assert.True(t, strings.HasPrefix(errMsg, "<11>1 "), errMsg)
+	assert.True(t, strings.HasSuffix(errMsg, "ERROR error\nstack$"))
+}
+
+func TestLineSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	sink := NewLineSink("udp", conn.LocalAddr().String())
+	_, _ = sink.Write([]byte("line\n"))
+	assert.NoError(t, sink.Sync())
+
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "line\n", string(buf[:n]))
+	assert.NoError(t, sink.Close())
+}
+
+func TestHTTPBulkSink(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, r.Header.Get("Content-Type")+"|"+string(b))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	es := NewHTTPBulkSink(server.URL, BulkElasticsearch, WithBulkIndex("logs"))
+	_, _ = es.Write([]byte(`{"msg":"json"}` + "\n"))
+	_, _ = es.Write([]byte("plain\n"))
+	assert.NoError(t, es.Close())
+
+	loki := NewHTTPBulkSink(server.URL, BulkLoki, WithLokiLabels(map[string]string{"app": "test"}))
+	_, _ = loki.Write([]byte("loki\n"))
+	assert.NoError(t, loki.Close())
+
+	assert.Len(t, bodies, 2)
+	lines := strings.Split(strings.TrimSuffix(bodies[0], "\n"), "\n")
+	assert.Equal(t, `application/x-ndjson|{"index":{"_index":"logs"}}`, lines[0])
+	assert.Equal(t, `{"msg":"json"}`, lines[1])
+	var doc map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(lines[3]), &doc))
+	assert.Equal(t, "plain", doc["message"])
+
+	var push struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		} `json:"streams"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(bodies[1], "application/json|")), &push))
+	assert.Equal(t, "test", push.Streams[0].Stream["app"])
+	assert.Equal(t, "loki", push.Streams[0].Values[0][1])
+}
+
+func TestSinkRetryAndSpool(t *testing.T) {
+	path, err := ioutil.TempDir("", "spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+	spool := filepath.Join(path, "bulk.spool")
+
+	var (
+		mu       sync.Mutex
+		down     = true
+		attempts int
+		received []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var push struct {
+			Streams []struct {
+				Values [][2]string `json:"values"`
+			} `json:"streams"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&push)
+		for _, v := range push.Streams[0].Values {
+			received = append(received, v[1])
+		}
+	}))
+	defer server.Close()
+
+	sink := NewHTTPBulkSink(server.URL, BulkLoki,
+		WithSinkRetry(2, time.Millisecond, time.Millisecond), WithSinkSpool(spool), WithSinkBatch(100, time.Hour))
+	_, _ = sink.Write([]byte("first\nline\n"))
+	assert.Error(t, sink.Sync())
+	assert.Equal(t, 3, attempts)
+	_, err = os.Stat(spool)
+	assert.NoError(t, err)
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	_, _ = sink.Write([]byte("second\n"))
+	assert.NoError(t, sink.Close())
+	assert.Equal(t, []string{"first\nline", "second"}, received)
+	_, err = os.Stat(spool)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSinkSpoolReplayInBatches(t *testing.T) {
+	path, err := ioutil.TempDir("", "spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+	spool := filepath.Join(path, "line.spool")
+
+	var (
+		down    = true
+		failOn  string
+		batches [][]string
+	)
+	send := func(entries []sinkEntry) error {
+		if down || string(entries[0].data) == failOn {
+			return errors.New("down")
+		}
+		batch := make([]string, len(entries))
+		for i, entry := range entries {
+			batch[i] = string(entry.data)
+		}
+		batches = append(batches, batch)
+		return nil
+	}
+	// 不启动后台goroutine, 只在Sync时发送
+	sink := &Sink{
+		opts: newSinkOptions(WithSinkRetry(0, time.Millisecond, time.Millisecond), WithSinkSpool(spool), WithSinkBatch(2, time.Hour)),
+		send: send,
+		full: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	for _, entry := range []string{"1", "2", "3", "4", "5"} {
+		_, _ = sink.Write([]byte(entry + "\n"))
+	}
+	assert.Error(t, sink.Sync())
+
+	// 第二批失败时只保留未发送成功的日志
+	down, failOn = false, "3"
+	assert.Error(t, sink.Sync())
+	assert.Equal(t, []string{"3", "4", "5"}, readSpool(t, spool))
+
+	failOn = ""
+	_, _ = sink.Write([]byte("6\n"))
+	assert.NoError(t, sink.Sync())
+	// spool中的日志按批发送, 不会附加到每一批
+	assert.Equal(t, [][]string{{"1", "2"}, {"3", "4"}, {"5"}, {"6"}}, batches)
+	_, err = os.Stat(spool)
+	assert.True(t, os.IsNotExist(err))
+
+	// 超过spool大小的日志被丢弃
+	down = true
+	// 时间的小数位数不固定, 留出余量但不足两条
+	sink.opts.spoolSize = int64(len(spoolLine(sinkEntry{time: time.Now(), data: []byte("7")}))) + 8
+	_, _ = sink.Write([]byte("7\n"))
+	_, _ = sink.Write([]byte("8\n"))
+	assert.EqualError(t, sink.Sync(), "hutils: spool log entries: hutils: spool is full, drop 1 log entries")
+	assert.Equal(t, []string{"7"}, readSpool(t, spool))
+}
+
+// readSpool 读取spool文件中的日志内容
+func readSpool(t *testing.T, path string) []string {
+	b, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	var entries []string
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if entry, ok := parseSpoolLine([]byte(line)); ok {
+			entries = append(entries, string(entry.data))
+		}
+	}
+	return entries
+}
+
+func TestSinkSpoolKeepsEntryTime(t *testing.T) {
+	path, err := ioutil.TempDir("", "spool")
+	assert.NoError(t, err)
+	defer os.RemoveAll(path)
+	spool := filepath.Join(path, "loki.spool")
+
+	var (
+		mu       sync.Mutex
+		down     = true
+		received [][2]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var push struct {
+			Streams []struct {
+				Values [][2]string `json:"values"`
+			} `json:"streams"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&push)
+		received = append(received, push.Streams[0].Values...)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPBulkSink(server.URL, BulkLoki,
+		WithSinkRetry(0, time.Millisecond, time.Millisecond), WithSinkSpool(spool), WithSinkBatch(100, time.Hour))
+	before := time.Now()
+	_, _ = sink.Write([]byte("first\n"))
+	_, _ = sink.Write([]byte("second\n"))
+	written := time.Now()
+	assert.Error(t, sink.Sync())
+	assert.Equal(t, []string{"first", "second"}, readSpool(t, spool))
+
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	assert.NoError(t, sink.Close())
+
+	// 从spool重新发送的日志使用写入Sink时的时间, 而不是发送时间
+	assert.Len(t, received, 2)
+	for i, entry := range []string{"first", "second"} {
+		assert.Equal(t, entry, received[i][1])
+		ts, err := strconv.ParseInt(received[i][0], 10, 64)
+		assert.NoError(t, err)
+		assert.False(t, time.Unix(0, ts).Before(before))
+		assert.False(t, time.Unix(0, ts).After(written))
+	}
+}
+
+func TestParseSpoolLine(t *testing.T) {
+	now := time.Now()
+	entry, ok := parseSpoolLine(spoolLine(sinkEntry{time: now, data: []byte("multi\nline")}))
+	assert.True(t, ok)
+	assert.Equal(t, "multi\nline", string(entry.data))
+	assert.True(t, now.Equal(entry.time))
+	// 兼容旧版本的spool文件
+	entry, ok = parseSpoolLine([]byte(`"legacy"` + "\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "legacy", string(entry.data))
+	_, ok = parseSpoolLine([]byte("broken"))
+	assert.False(t, ok)
+}
+
+func TestSinkPartialSend(t *testing.T) {
+	var (
+		sent  []string
+		calls int
+	)
+	// 第一次只发送成功一条
+	send := func(entries []sinkEntry) error {
+		calls++
+		for i, entry := range entries {
+			if calls == 1 && i == 1 {
+				return &sendError{remaining: entries[i:], err: errors.New("broken pipe")}
+			}
+			sent = append(sent, string(entry.data))
+		}
+		return nil
+	}
+	sink := newSink(send, newSinkOptions(WithSinkRetry(1, time.Millisecond, time.Millisecond), WithSinkBatch(10, time.Hour)))
+	_, _ = sink.Write([]byte("a\n"))
+	_, _ = sink.Write([]byte("b\n"))
+	assert.NoError(t, sink.Close())
+	assert.Equal(t, []string{"a", "b"}, sent)
+
+	_, err := sink.Write([]byte("closed\n"))
+	assert.Equal(t, ErrSinkClosed, err)
+}
+
+func TestHTTPBulkSinkItemErrors(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests [][]string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		var docs []string
+		lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		for i := 1; i < len(lines); i += 2 {
+			docs = append(docs, lines[i])
+		}
+		mu.Lock()
+		requests = append(requests, docs)
+		first := len(requests) == 1
+		mu.Unlock()
+		if !first {
+			_, _ = w.Write([]byte(`{"errors":false,"items":[]}`))
+			return
+		}
+		// 第一次请求: ok成功, retry限流, bad无法写入
+		_, _ = w.Write([]byte(`{"errors":true,"items":[` +
+			`{"index":{"status":201}},` +
+			`{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}},` +
+			`{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`))
+	}))
+	defer server.Close()
+
+	sink := NewHTTPBulkSink(server.URL, BulkElasticsearch, WithSinkRetry(1, time.Millisecond, time.Millisecond))
+	_, _ = sink.Write([]byte(`{"msg":"ok"}` + "\n"))
+	_, _ = sink.Write([]byte(`{"msg":"retry"}` + "\n"))
+	_, _ = sink.Write([]byte(`{"msg":"bad"}` + "\n"))
+	err := sink.Close()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "2 failed items")
+	assert.Equal(t, [][]string{
+		{`{"msg":"ok"}`, `{"msg":"retry"}`, `{"msg":"bad"}`},
+		{`{"msg":"retry"}`},
+	}, requests)
+}
+
+func TestLoggerSinks(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received <- string(b)
+	}))
+	defer server.Close()
+
+	logger := &Logger{}
+	sugarLog := logger.Init(LoggerOpt{
+		Sinks: []zapcore.WriteSyncer{NewHTTPBulkSink(server.URL, BulkElasticsearch)},
+	}).Sugar()
+	sugarLog.Info("TestLoggerSinks")
+	assert.NoError(t, logger.Close())
+	assert.Contains(t, <-received, "TestLoggerSinks")
+}
+
+func TestAsyncLoggerSinks(t *testing.T) {
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received <- string(b)
+	}))
+	defer server.Close()
+
+	logger := &Logger{}
+	sugarLog := logger.Init(LoggerOpt{
+		Async: &AsyncOpt{FlushInterval: time.Hour},
+		Sinks: []zapcore.WriteSyncer{NewHTTPBulkSink(server.URL, BulkLoki, WithSinkBatch(100, time.Hour))},
+	}).Sugar()
+	for i := 0; i < 5; i++ {
+		sugarLog.Infof("TestAsyncLoggerSinks-%d", i)
+	}
+	assert.NoError(t, logger.Close())
+
+	var push struct {
+		Streams []struct {
+			Values [][2]string `json:"values"`
+		} `json:"streams"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(<-received), &push))
+	// 异步写入时每条日志仍是单独的一条记录
+	values := push.Streams[0].Values
+	assert.Len(t, values, 5)
+	for i, value := range values {
+		assert.Contains(t, value[1], "TestAsyncLoggerSinks-"+strconv.Itoa(i))
+		assert.NotContains(t, value[1], "\n")
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	assert.Equal(t, 7, syslogSeverity([]byte("time DEBUG msg")))
+	assert.Equal(t, 4, syslogSeverity([]byte(`{"level":"WARN","msg":"ERROR"}`)))
+	assert.Equal(t, 2, syslogSeverity([]byte("time DPANIC msg")))
+	assert.Equal(t, 6, syslogSeverity([]byte("no level")))
+}
@@ -0,0 +1,118 @@
+package hutils
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/SkyAPM/go2sky"
+	"go.elastic.co/apm"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerKind 链路追踪的实现
+type TracerKind string
+
+const (
+	TracerOtel       TracerKind = "otel"
+	TracerSkywalking TracerKind = "skywalking"
+	TracerApm        TracerKind = "apm"
+)
+
+// TraceContext 当前请求的trace信息
+type TraceContext struct {
+	Kind    TracerKind
+	TraceID string
+	SpanID  string
+}
+
+// IsValid 是否获取到了trace信息
+func (c TraceContext) IsValid() bool {
+	return c.TraceID != ""
+}
+
+var tracePriority atomic.Value
+
+func init() {
+	tracePriority.Store([]TracerKind{TracerOtel, TracerSkywalking, TracerApm})
+}
+
+var traceResolvers = map[TracerKind]func(ctx context.Context) TraceContext{
+	TracerOtel:       otelTraceContext,
+	TracerSkywalking: skywalkingTraceContext,
+	TracerApm:        apmTraceContext,
+}
+
+// SetTracePriority 设置获取trace信息时各实现的优先级, 默认为otel, skywalking, apm.
+// 未列出的实现不会被使用.
+func SetTracePriority(kinds ...TracerKind) {
+	tracePriority.Store(append([]TracerKind(nil), kinds...))
+}
+
+// TraceContextFromContext 按优先级从ctx中获取第一个有效的trace信息.
+// otel span没有被采样时(如未配置TracerProvider)优先使用其他实现, 都没有时才使用otel的trace信息.
+func TraceContextFromContext(ctx context.Context) TraceContext {
+	if ctx == nil {
+		return TraceContext{}
+	}
+	var fallback TraceContext
+	for _, kind := range tracePriority.Load().([]TracerKind) {
+		resolver, ok := traceResolvers[kind]
+		if !ok {
+			continue
+		}
+		c := resolver(ctx)
+		if !c.IsValid() {
+			continue
+		}
+		if kind == TracerOtel && !otelSpanSampled(ctx) {
+			fallback = c
+			continue
+		}
+		return c
+	}
+	return fallback
+}
+
+// otelSpanSampled 当前otel span是否正在记录或者已被采样
+func otelSpanSampled(ctx context.Context) bool {
+	span := trace.SpanFromContext(ctx)
+	return span.IsRecording() || span.SpanContext().IsSampled()
+}
+
+func otelTraceContext(ctx context.Context) TraceContext {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.HasTraceID() {
+		return TraceContext{}
+	}
+	c := TraceContext{Kind: TracerOtel, TraceID: spanCtx.TraceID().String()}
+	if spanCtx.HasSpanID() {
+		c.SpanID = spanCtx.SpanID().String()
+	}
+	return c
+}
+
+// skywalkingTraceContext span id为segment id和span id的组合, 与skywalking ui中的一致
+func skywalkingTraceContext(ctx context.Context) TraceContext {
+	traceID := go2sky.TraceID(ctx)
+	if traceID == "" || traceID == go2sky.EmptyTraceID {
+		return TraceContext{}
+	}
+	return TraceContext{
+		Kind:    TracerSkywalking,
+		TraceID: traceID,
+		SpanID:  fmt.Sprintf("%s-%d", go2sky.TraceSegmentID(ctx), go2sky.SpanID(ctx)),
+	}
+}
+
+func apmTraceContext(ctx context.Context) TraceContext {
+	if span := apm.SpanFromContext(ctx); span != nil {
+		traceCtx := span.TraceContext()
+		return TraceContext{Kind: TracerApm, TraceID: traceCtx.Trace.String(), SpanID: traceCtx.Span.String()}
+	}
+	if tx := apm.TransactionFromContext(ctx); tx != nil {
+		traceCtx := tx.TraceContext()
+		return TraceContext{Kind: TracerApm, TraceID: traceCtx.Trace.String(), SpanID: traceCtx.Span.String()}
+	}
+	return TraceContext{}
+}
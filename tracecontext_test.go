@@ -0,0 +1,80 @@
+package hutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SkyAPM/go2sky"
+	"github.com/stretchr/testify/assert"
+	"go.elastic.co/apm"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextFromContext(t *testing.T) {
+	defer SetTracePriority(TracerOtel, TracerSkywalking, TracerApm)
+	assert.False(t, TraceContextFromContext(nil).IsValid())
+	assert.False(t, TraceContextFromContext(context.Background()).IsValid())
+
+	// skywalking
+	recorder := &spanRecorder{spans: make(chan go2sky.ReportedSpan, 1)}
+	tracer, err := go2sky.NewTracer("test", go2sky.WithReporter(recorder))
+	assert.NoError(t, err)
+	span, ctx, err := tracer.CreateLocalSpan(context.Background())
+	assert.NoError(t, err)
+	defer span.End()
+	swCtx := TraceContextFromContext(ctx)
+	assert.Equal(t, TracerSkywalking, swCtx.Kind)
+	assert.Equal(t, go2sky.TraceID(ctx), swCtx.TraceID)
+
+	// apm
+	tx := apm.DefaultTracer.StartTransaction("test", "test")
+	defer tx.End()
+	ctx = apm.ContextWithTransaction(ctx, tx)
+	SetTracePriority(TracerApm, TracerSkywalking)
+	apmCtx := TraceContextFromContext(ctx)
+	assert.Equal(t, TracerApm, apmCtx.Kind)
+	assert.Equal(t, tx.TraceContext().Trace.String(), apmCtx.TraceID)
+
+	// otel
+	traceID, _ := trace.TraceIDFromHex(testTraceID)
+	spanID, _ := trace.SpanIDFromHex("a221978841e89dac")
+	unsampled := trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	SetTracePriority(TracerOtel, TracerSkywalking, TracerApm)
+	// 未采样的otel span不会覆盖skywalking
+	assert.Equal(t, swCtx.TraceID, TraceIDFromContext(unsampled))
+	SetTracePriority(TracerOtel)
+	assert.Equal(t, testTraceID, TraceIDFromContext(unsampled))
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+	SetTracePriority(TracerApm, TracerOtel)
+	assert.Equal(t, tx.TraceContext().Trace.String(), TraceIDFromContext(ctx))
+	SetTracePriority(TracerOtel, TracerSkywalking, TracerApm)
+	assert.Equal(t, testTraceID, TraceIDFromContext(ctx))
+	assert.Equal(t, "a221978841e89dac", SpanIDFromContext(ctx))
+
+	// ZError与日志使用同一个trace id
+	SetTracePriority(TracerSkywalking)
+	z := NewZError(ctx, 10086, "error")
+	assert.Equal(t, swCtx.TraceID, z.TraceID)
+	assert.Equal(t, swCtx.SpanID, z.SpanID)
+}
+
+func TestUnionLogTraceFields(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex(testTraceID)
+	spanID, _ := trace.SpanIDFromHex("a221978841e89dac")
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		UnionLog{}.Log(ctx, sugarLog)
+		UnionLog{ExtraFields: map[string]GetExtraField{
+			"trace_id": func(ctx context.Context) string { return "custom" },
+		}}.Log(ctx, sugarLog)
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, output[0], `"trace_id": "`+testTraceID+`"`)
+	assert.Contains(t, output[0], `"span_id": "a221978841e89dac"`)
+	assert.Contains(t, output[1], `"trace_id": "custom"`)
+	assert.NotContains(t, output[1], testTraceID)
+}
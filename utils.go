@@ -12,6 +12,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"go.uber.org/zap/zapcore"
 )
 
 // JSONMarshal 类似json.Marshal(), 但不转义特殊符号
@@ -111,3 +112,77 @@ func (z ZError) ErrCode() string {
 func (z ZError) ErrMessage() string {
 	return z.Message
 }
+
+// Unwrap 返回被包装的错误, 支持errors.Is/errors.As
+func (z ZError) Unwrap() error {
+	return z.Err
+}
+
+// Is 业务码相同的ZError视为同一错误, 可以用于errors.Is(err, ErrNotFound)
+func (z ZError) Is(target error) bool {
+	switch t := target.(type) {
+	case ZError:
+		return t.Code != "" && t.Code == z.Code
+	case *ZError:
+		return t != nil && t.Code != "" && t.Code == z.Code
+	}
+	return false
+}
+
+// As 支持ZError与*ZError互相转换
+func (z ZError) As(target interface{}) bool {
+	switch t := target.(type) {
+	case *ZError:
+		*t = z
+		return true
+	case **ZError:
+		*t = &z
+		return true
+	}
+	return false
+}
+
+// Format %+v输出业务码、信息、trace id以及被包装错误的堆栈, 其他格式同Error()
+func (z ZError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%s\ntrace_id: %s, span_id: %s", z.Error(), z.TraceID, z.SpanID)
+			if z.Err != nil {
+				fmt.Fprintf(s, "\ncaused by: %+v", z.Err)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		_, _ = io.WriteString(s, z.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", z.Error())
+	default:
+		_, _ = io.WriteString(s, z.Error())
+	}
+}
+
+// MarshalLogObject 实现zapcore.ObjectMarshaler, 使用zap.Any/zap.Object记录时输出结构化字段
+func (z ZError) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("code", z.Code)
+	enc.AddString("message", z.Message)
+	if z.TraceID != "" {
+		enc.AddString("trace_id", z.TraceID)
+	}
+	if z.SpanID != "" {
+		enc.AddString("span_id", z.SpanID)
+	}
+	if z.Err != nil {
+		enc.AddString("cause", z.Err.Error())
+		if stack := stackEntries(z.Err); len(stack) > 0 {
+			return enc.AddArray("stack", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+				for _, entry := range stack {
+					arr.AppendString(entry)
+				}
+				return nil
+			}))
+		}
+	}
+	return nil
+}
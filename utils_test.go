@@ -3,10 +3,16 @@ package hutils
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestJSONMarshal(t *testing.T) {
@@ -51,3 +57,46 @@ func TestNewZError(t *testing.T) {
 	err = NewZError(nil, "10087", "TestNewZError", WithError(err))
 	assert.Equal(t, "10086: TestNewZError", err.Err.Error())
 }
+
+func TestZErrorChain(t *testing.T) {
+	cause := errors.New("record not found")
+	z := NewZError(nil, "40404", "TestZErrorChain", WithError(cause))
+	err := errors.Wrap(z, "query user")
+
+	assert.True(t, errors.Is(err, cause))
+	assert.True(t, errors.Is(err, ZError{Code: "40404"}))
+	assert.False(t, errors.Is(err, &ZError{Code: "40405"}))
+
+	var value ZError
+	assert.True(t, errors.As(err, &value))
+	assert.Equal(t, "40404", value.Code)
+	var pointer *ZError
+	assert.True(t, errors.As(fmt.Errorf("wrap: %w", *z), &pointer))
+	assert.Equal(t, "TestZErrorChain", pointer.Message)
+}
+
+func TestZErrorFormat(t *testing.T) {
+	z := NewZError(nil, "40404", "TestZErrorFormat", WithError(errors.New("record not found")))
+	z.TraceID = testTraceID
+	assert.Equal(t, "40404: TestZErrorFormat", fmt.Sprintf("%v", z))
+	assert.Equal(t, `"40404: TestZErrorFormat"`, fmt.Sprintf("%q", z))
+	verbose := fmt.Sprintf("%+v", z)
+	assert.True(t, strings.HasPrefix(verbose, "40404: TestZErrorFormat\ntrace_id: "+testTraceID))
+	assert.Contains(t, verbose, "caused by: record not found")
+	assert.Contains(t, verbose, "TestZErrorFormat")
+	assert.Contains(t, verbose, "utils_test.go")
+}
+
+func TestZErrorMarshalLogObject(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	z := NewZError(nil, "40404", "TestZErrorMarshalLogObject", WithError(errors.New("record not found")))
+	z.TraceID = testTraceID
+	zap.New(core).Error("failed", zap.Object("error", z))
+
+	fields := logs.All()[0].ContextMap()["error"].(map[string]interface{})
+	assert.Equal(t, "40404", fields["code"])
+	assert.Equal(t, "TestZErrorMarshalLogObject", fields["message"])
+	assert.Equal(t, testTraceID, fields["trace_id"])
+	assert.Equal(t, "record not found", fields["cause"])
+	assert.NotEmpty(t, fields["stack"])
+}
@@ -5,11 +5,11 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"os"
+	"reflect"
+	"sort"
+	"sync/atomic"
 	"time"
 
-	rotateLogs "github.com/lestrrat-go/file-rotatelogs"
-	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -20,10 +20,32 @@ func SetServiceName(name string) {
 	serviceName = name
 }
 
+// LogSchemaVersion AccessLog, RequestLog结构化日志字段的版本, 字段变化时递增
+const LogSchemaVersion = "1"
+
+const (
+	schemaVersionKey  = "schema_version"
+	accessLogMessage  = "access"
+	requestLogMessage = "request"
+)
+
+// legacyLogFormat AccessLog, RequestLog使用旧的printf格式输出, 兼容已有的日志解析
+var legacyLogFormat atomic.Bool
+
+func init() {
+	legacyLogFormat.Store(GetEnv("LEGACY_LOG_FORMAT", "false") == "true")
+}
+
+// SetLegacyLogFormat 是否使用旧的printf格式输出AccessLog, RequestLog, 也可以通过环境变量LEGACY_LOG_FORMAT=true开启
+func SetLegacyLogFormat(legacy bool) {
+	legacyLogFormat.Store(legacy)
+}
+
 const (
-	timeFormatter  = "2006-01-02 15:04:05"
-	defaultLogType = "http"
-	grpcLogType    = "grpc"
+	timeFormatter     = "2006-01-02 15:04:05"
+	defaultLogType    = "http"
+	grpcLogType       = "grpc"
+	grpcClientLogType = "grpc_client"
 )
 
 type LogType string
@@ -39,6 +61,10 @@ const (
 type Logger struct {
 	Type    LogType
 	LogPath string
+	level   zap.AtomicLevel
+	name    string
+	asyncs  []*AsyncWriteSyncer
+	sinks   []zapcore.WriteSyncer
 }
 
 type LoggerOpt struct {
@@ -48,16 +74,69 @@ type LoggerOpt struct {
 	EnableFile           bool
 	IsUnion              bool
 	IsJSONEncoder        bool
+	// MinLevel 最低日志级别, 默认union为Debug, 其他为Info
+	MinLevel *zapcore.Level
+	// Name 注册到RegisterLogLevel的名称, 默认为Type, Type为空时为default
+	Name string
+	// Rotation 日志文件切割配置, 为nil时按天切割并保留30天
+	Rotation *RotationOpt
+	// Async 不为nil时异步写日志, 退出前需要调用Logger.Close
+	Async *AsyncOpt
+	// Sinks 额外的日志输出, 如NewSyslogSink, NewLineSink, NewHTTPBulkSink, Logger.Close时会关闭实现了io.Closer的输出
+	Sinks []zapcore.WriteSyncer
+	// Routes union模式下按级别或LogType输出到不同的writer, 未匹配的日志使用默认输出
+	Routes []LogRoute
 }
 
+// Init 同Build, 出错时panic
 func (l *Logger) Init(opt LoggerOpt) (logger *zap.Logger) {
-	var writers []zapcore.WriteSyncer
-	if opt.EnableStdout {
-		writers = append(writers, zapcore.AddSync(os.Stdout))
+	logger, err := l.Build(opt)
+	if err != nil {
+		log.Panic(err)
+	}
+	return logger
+}
+
+// Build 按配置创建logger, 日志文件切割配置错误时返回error.
+// 重新Build时会写入之前异步队列中剩余的日志, 并关闭不再使用的Sinks, 之前返回的logger不应再使用.
+func (l *Logger) Build(opt LoggerOpt) (*zap.Logger, error) {
+	keep := append([]zapcore.WriteSyncer(nil), opt.Sinks...)
+	for _, route := range opt.Routes {
+		keep = append(keep, route.Writers...)
+	}
+	if err := l.closeWriters(keep); err != nil {
+		log.Println(err)
 	}
+	var fileType LogType
 	if opt.EnableFile {
-		writers = append(writers, zapcore.AddSync(l.fileRotateWriter()))
+		fileType = l.Type
+	}
+	writer, err := l.newWriter(opt, opt.EnableStdout, fileType, opt.Sinks)
+	if err != nil {
+		return nil, err
+	}
+	minLevel := zapcore.InfoLevel
+	if opt.IsUnion {
+		minLevel = zapcore.DebugLevel
+	}
+	if opt.MinLevel != nil {
+		minLevel = *opt.MinLevel
+	}
+	// 重新Build时替换之前注册的日志级别
+	if l.name != "" {
+		UnregisterLogLevel(l.name, l.level)
 	}
+	l.level = zap.NewAtomicLevelAt(minLevel)
+	name := opt.Name
+	if name == "" {
+		name = string(l.Type)
+	}
+	if name == "" {
+		name = defaultLoggerName
+	}
+	RegisterLogLevel(name, l.level)
+	l.name = name
+
 	var core zapcore.Core
 	if opt.IsUnion {
 		encoderMap := make(map[zapcore.Level]zapcore.EncoderConfig)
@@ -67,22 +146,48 @@ func (l *Logger) Init(opt LoggerOpt) (logger *zap.Logger) {
 		for level, encoder := range opt.CustomEncoderConfigs {
 			encoderMap[level] = *encoder
 		}
-		cores := make([]zapcore.Core, len(encoderMap))
-		i := 0
-		for key, encoderConfig := range encoderMap {
-			level := key
-			encoder := zapcore.NewConsoleEncoder(encoderConfig)
-			if opt.IsJSONEncoder {
-				encoder = zapcore.NewJSONEncoder(encoderConfig)
+		levels := make([]zapcore.Level, 0, len(encoderMap))
+		for level := range encoderMap {
+			levels = append(levels, level)
+		}
+		sort.Slice(levels, func(i, j int) bool {
+			return levels[i] < levels[j]
+		})
+		routeWriters := make([]zapcore.WriteSyncer, len(opt.Routes))
+		for i, route := range opt.Routes {
+			if routeWriters[i], err = l.newWriter(opt, route.EnableStdout, route.Type, route.Writers); err != nil {
+				return nil, err
+			}
+		}
+		unrouted := func(lev zapcore.Level, logType LogType) bool {
+			for _, route := range opt.Routes {
+				if route.match(lev, logType) {
+					return false
+				}
+			}
+			return true
+		}
+		var cores []zapcore.Core
+		for i, level := range levels {
+			encoderConfig := encoderMap[level]
+			newEncoder := func() zapcore.Encoder {
+				if opt.IsJSONEncoder {
+					return zapcore.NewJSONEncoder(encoderConfig)
+				}
+				return zapcore.NewConsoleEncoder(encoderConfig)
+			}
+			// 每个级别使用不高于它的最近一个级别的encoder, 如Warn使用Info的encoder
+			lower, upper := level, zapcore.FatalLevel+1
+			if i+1 < len(levels) {
+				upper = levels[i+1]
+			}
+			enabler := zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
+				return lev >= lower && lev < upper && l.level.Enabled(lev)
+			})
+			cores = append(cores, &routeCore{Core: zapcore.NewCore(newEncoder(), writer, enabler), match: unrouted})
+			for j, route := range opt.Routes {
+				cores = append(cores, &routeCore{Core: zapcore.NewCore(newEncoder(), routeWriters[j], enabler), match: route.match})
 			}
-			cores[i] = zapcore.NewCore(
-				encoder,
-				zapcore.NewMultiWriteSyncer(writers...),
-				zap.LevelEnablerFunc(func(lev zapcore.Level) bool {
-					return lev == level
-				}),
-			)
-			i++
 		}
 		core = zapcore.NewTee(cores...)
 	} else {
@@ -98,27 +203,71 @@ func (l *Logger) Init(opt LoggerOpt) (logger *zap.Logger) {
 		if opt.CustomEncoderConfig != nil {
 			enc = *opt.CustomEncoderConfig
 		}
-		core = zapcore.NewCore(
-			zapcore.NewConsoleEncoder(enc),
-			zapcore.NewMultiWriteSyncer(writers...),
-			zap.NewAtomicLevelAt(zapcore.InfoLevel),
-		)
-	}
-	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)).Named(serviceName)
-}
-
-func (l *Logger) fileRotateWriter() io.Writer {
-	filePath := l.filePath()
-	hook, err := rotateLogs.New(
-		filePath+".%Y-%m-%d",
-		rotateLogs.WithLinkName(filePath),
-		rotateLogs.WithMaxAge(time.Hour*24*30),
-		rotateLogs.WithRotationTime(time.Hour*24),
-	)
-	if err != nil {
-		log.Panic(err)
+		encoder := zapcore.NewConsoleEncoder(enc)
+		if opt.IsJSONEncoder {
+			encoder = zapcore.NewJSONEncoder(enc)
+		}
+		core = zapcore.NewCore(encoder, writer, l.level)
+	}
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zapcore.ErrorLevel)).Named(serviceName), nil
+}
+
+// Close 异步写日志时写入剩余的日志, 关闭Sinks并取消注册日志级别
+func (l *Logger) Close() error {
+	if l.name != "" {
+		UnregisterLogLevel(l.name, l.level)
+		l.name = ""
+	}
+	return l.closeWriters(nil)
+}
+
+// closeWriters 写入异步队列中剩余的日志并关闭Sinks, keep中的writer仍会继续使用, 不会被关闭
+func (l *Logger) closeWriters(keep []zapcore.WriteSyncer) error {
+	var err error
+	for _, async := range l.asyncs {
+		if closeErr := async.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	for _, sink := range l.sinks {
+		if containsWriter(keep, sink) {
+			continue
+		}
+		if closer, ok := sink.(io.Closer); ok {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
 	}
-	return hook
+	l.asyncs, l.sinks = nil, nil
+	return err
+}
+
+func containsWriter(writers []zapcore.WriteSyncer, w zapcore.WriteSyncer) bool {
+	// 不可比较的类型无法判断是否为同一个writer
+	if !reflect.TypeOf(w).Comparable() {
+		return false
+	}
+	for _, writer := range writers {
+		if reflect.TypeOf(writer) == reflect.TypeOf(w) && writer == w {
+			return true
+		}
+	}
+	return false
+}
+
+// Dropped 异步写日志时因队列已满丢弃的日志条数
+func (l *Logger) Dropped() uint64 {
+	var dropped uint64
+	for _, async := range l.asyncs {
+		dropped += async.Dropped()
+	}
+	return dropped
+}
+
+// Level Init之后可以通过返回的AtomicLevel在运行时修改日志级别
+func (l *Logger) Level() zap.AtomicLevel {
+	return l.level
 }
 
 func (l *Logger) filePath() string {
@@ -165,20 +314,14 @@ func TrackEncoderConfig() zapcore.EncoderConfig {
 	}
 }
 
+// SpanIDFromContext 按SetTracePriority的优先级获取当前span id
 func SpanIDFromContext(ctx context.Context) string {
-	spanCtx := trace.SpanContextFromContext(ctx)
-	if spanCtx.HasSpanID() {
-		return spanCtx.SpanID().String()
-	}
-	return ""
+	return TraceContextFromContext(ctx).SpanID
 }
 
+// TraceIDFromContext 按SetTracePriority的优先级获取当前trace id
 func TraceIDFromContext(ctx context.Context) string {
-	spanCtx := trace.SpanContextFromContext(ctx)
-	if spanCtx.HasTraceID() {
-		return spanCtx.TraceID().String()
-	}
-	return ""
+	return TraceContextFromContext(ctx).TraceID
 }
 
 type AccessLog struct {
@@ -196,28 +339,54 @@ type AccessLog struct {
 }
 
 func (l AccessLog) Log(logger *zap.SugaredLogger) {
-	logType := defaultLogType
-	if l.LogType != "" {
-		logType = l.LogType
+	if legacyLogFormat.Load() {
+		logger.Infow(fmt.Sprintf(
+			"%s %s %s $%q$ %s %d %d \"%s\" %s $%q$ %s %s",
+			l.ClientIP, l.Method, l.Request, l.Payload, l.Protocol,
+			l.StatusCode, l.Duration, l.Agent, serviceName, l.Response, l.logType(), l.GrpcStatus,
+		), logTypeField(ACCESS))
+		return
 	}
-	logger.Infof(
-		"%s %s %s $%q$ %s %d %d \"%s\" %s $%q$ %s %s",
-		l.ClientIP, l.Method, l.Request, l.Payload, l.Protocol,
-		l.StatusCode, l.Duration, l.Agent, serviceName, l.Response, logType, l.GrpcStatus,
-	)
+	logger.Infow(accessLogMessage, append(l.fields(), logTypeField(ACCESS))...)
 }
 
 func (l AccessLog) LogWithContext(ctx context.Context, logger *zap.SugaredLogger) {
-	logType := defaultLogType
+	if legacyLogFormat.Load() {
+		logger.Infow(fmt.Sprintf(
+			"%s %s %s $%q$ %s %d %d \"%s\" %s $%q$ %s %s %s %s",
+			l.ClientIP, l.Method, l.Request, l.Payload, l.Protocol,
+			l.StatusCode, l.Duration, l.Agent, serviceName, l.Response, l.logType(), l.GrpcStatus,
+			TraceIDFromContext(ctx), SpanIDFromContext(ctx),
+		), logTypeField(ACCESS))
+		return
+	}
+	logger.Infow(accessLogMessage, append(append(l.fields(), traceFields(ctx)...), logTypeField(ACCESS))...)
+}
+
+func (l AccessLog) logType() string {
 	if l.LogType != "" {
-		logType = l.LogType
+		return l.LogType
+	}
+	return defaultLogType
+}
+
+// fields LogSchemaVersion版本的访问日志字段
+func (l AccessLog) fields() []interface{} {
+	return []interface{}{
+		zap.String(schemaVersionKey, LogSchemaVersion),
+		zap.String("client_ip", l.ClientIP),
+		zap.String("method", l.Method),
+		zap.String("request", l.Request),
+		zap.ByteString("payload", l.Payload),
+		zap.String("protocol", l.Protocol),
+		zap.Int("status_code", l.StatusCode),
+		zap.Int64("duration", l.Duration),
+		zap.String("agent", l.Agent),
+		zap.String("service", serviceName),
+		zap.ByteString("response", l.Response),
+		zap.String("log_type", l.logType()),
+		zap.String("grpc_status", l.GrpcStatus),
 	}
-	logger.Infof(
-		"%s %s %s $%q$ %s %d %d \"%s\" %s $%q$ %s %s %s %s",
-		l.ClientIP, l.Method, l.Request, l.Payload, l.Protocol,
-		l.StatusCode, l.Duration, l.Agent, serviceName, l.Response, logType, l.GrpcStatus,
-		TraceIDFromContext(ctx), SpanIDFromContext(ctx),
-	)
 }
 
 type RequestLog struct {
@@ -230,18 +399,49 @@ type RequestLog struct {
 }
 
 func (l RequestLog) Log(logger *zap.SugaredLogger) {
-	logger.Infof(
-		"%s %s %d %s $%q$ %s $%q$ %s",
-		l.Method, l.Duration, l.Request, l.Payload, l.StatusDescription, l.Response, serviceName,
-	)
+	if legacyLogFormat.Load() {
+		logger.Infow(fmt.Sprintf(
+			"%s %d %s $%q$ %s $%q$ %s",
+			l.Method, l.Duration, l.Request, l.Payload, l.StatusDescription, l.Response, serviceName,
+		), logTypeField(REQUEST))
+		return
+	}
+	logger.Infow(requestLogMessage, append(l.fields(), logTypeField(REQUEST))...)
 }
 
 func (l RequestLog) LogWithContext(ctx context.Context, logger *zap.SugaredLogger) {
-	logger.Infof(
-		"%s %d %s $%q$ %s $%q$ %s %s %s",
-		l.Method, l.Duration, l.Request, l.Payload, l.StatusDescription, l.Response, serviceName,
-		TraceIDFromContext(ctx), SpanIDFromContext(ctx),
-	)
+	if legacyLogFormat.Load() {
+		logger.Infow(fmt.Sprintf(
+			"%s %d %s $%q$ %s $%q$ %s %s %s",
+			l.Method, l.Duration, l.Request, l.Payload, l.StatusDescription, l.Response, serviceName,
+			TraceIDFromContext(ctx), SpanIDFromContext(ctx),
+		), logTypeField(REQUEST))
+		return
+	}
+	logger.Infow(requestLogMessage, append(append(l.fields(), traceFields(ctx)...), logTypeField(REQUEST))...)
+}
+
+// fields LogSchemaVersion版本的请求日志字段
+func (l RequestLog) fields() []interface{} {
+	return []interface{}{
+		zap.String(schemaVersionKey, LogSchemaVersion),
+		zap.String("method", l.Method),
+		zap.Int64("duration", l.Duration),
+		zap.String("request", l.Request),
+		zap.ByteString("payload", l.Payload),
+		zap.String("status_description", l.StatusDescription),
+		zap.ByteString("response", l.Response),
+		zap.String("service", serviceName),
+	}
+}
+
+// traceFields ctx中有trace时返回trace_id, span_id字段
+func traceFields(ctx context.Context) []interface{} {
+	traceCtx := TraceContextFromContext(ctx)
+	if !traceCtx.IsValid() {
+		return nil
+	}
+	return []interface{}{zap.String("trace_id", traceCtx.TraceID), zap.String("span_id", traceCtx.SpanID)}
 }
 
 type GetExtraField func(ctx context.Context) string
@@ -259,6 +459,11 @@ type UnionLog struct {
 	Response    []byte
 	Duration    int64
 	StatusCode  int
+	// 下游服务地址, 仅客户端日志使用
+	Target string
+	// stream中收发的消息数
+	MsgReceived int
+	MsgSent     int
 }
 
 func (l UnionLog) GetExtraFields(ctx context.Context, baseInfo []interface{}) []interface{} {
@@ -268,6 +473,15 @@ func (l UnionLog) GetExtraFields(ctx context.Context, baseInfo []interface{}) []
 		values[i] = zap.String(k, f(ctx))
 		i++
 	}
+	// ExtraFields中未自定义时自动记录trace信息
+	if traceCtx := TraceContextFromContext(ctx); traceCtx.IsValid() {
+		if _, ok := l.ExtraFields["trace_id"]; !ok {
+			values = append(values, zap.String("trace_id", traceCtx.TraceID))
+		}
+		if _, ok := l.ExtraFields["span_id"]; !ok {
+			values = append(values, zap.String("span_id", traceCtx.SpanID))
+		}
+	}
 	if baseInfo != nil {
 		values = append(values, baseInfo...)
 	}
@@ -291,7 +505,13 @@ func (l UnionLog) Log(ctx context.Context, logger *zap.SugaredLogger) {
 		zap.Int("status_code", l.StatusCode),
 		zap.String("log_type", logType),
 		zap.String("grpc_status", l.GrpcStatus)}
-	values := l.GetExtraFields(ctx, baseInfo)
+	if l.Target != "" {
+		baseInfo = append(baseInfo, zap.String("target", l.Target))
+	}
+	if l.MsgReceived > 0 || l.MsgSent > 0 {
+		baseInfo = append(baseInfo, zap.Int("msg_received", l.MsgReceived), zap.Int("msg_sent", l.MsgSent))
+	}
+	values := l.GetExtraFields(ctx, append(baseInfo, logTypeField(ACCESS)))
 	logger.Infow("", values...)
 }
 
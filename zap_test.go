@@ -2,6 +2,7 @@ package hutils
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"os"
@@ -99,3 +100,44 @@ func TestStdoutLogWithContext(t *testing.T) {
 	assert.True(t, strings.Index(output[1], traceID.String()) == -1)
 	assert.True(t, strings.Index(output[1], spanID.String()) == -1)
 }
+
+func TestStructuredAccessLog(t *testing.T) {
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true, IsJSONEncoder: true}).Sugar()
+		AccessLog{ClientIP: "1.2.3.4", Request: "/ping", Payload: []byte(`{"a":1}`), StatusCode: 200}.Log(sugarLog)
+		RequestLog{Method: "GET", Request: "/ping", Duration: 12}.Log(sugarLog)
+	})
+	assert.NoError(t, err)
+
+	var access map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(output[0]), &access))
+	assert.Equal(t, "access", access["msg"])
+	assert.Equal(t, LogSchemaVersion, access["schema_version"])
+	assert.Equal(t, "1.2.3.4", access["client_ip"])
+	assert.Equal(t, `{"a":1}`, access["payload"])
+	assert.Equal(t, float64(200), access["status_code"])
+	assert.Equal(t, "http", access["log_type"])
+
+	var request map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(output[1]), &request))
+	assert.Equal(t, "request", request["msg"])
+	assert.Equal(t, "/ping", request["request"])
+	assert.Equal(t, float64(12), request["duration"])
+}
+
+func TestLegacyLogFormat(t *testing.T) {
+	SetLegacyLogFormat(true)
+	defer SetLegacyLogFormat(false)
+	output, err := CaptureStdout(func() {
+		logger := &Logger{}
+		sugarLog := logger.Init(LoggerOpt{EnableStdout: true}).Sugar()
+		AccessLog{ClientIP: "1.2.3.4", Method: "GET", Request: "/ping", StatusCode: 200}.Log(sugarLog)
+		RequestLog{Method: "GET", Request: "/ping", Duration: 12}.Log(sugarLog)
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, output[0], `1.2.3.4 GET /ping $""$  200 0 "" `)
+	// Duration与Request的顺序与LogWithContext一致
+	assert.Contains(t, output[1], `GET 12 /ping $""$  $""$ `)
+	assert.NotContains(t, output[1], "%!")
+}